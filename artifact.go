@@ -0,0 +1,194 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// artifactFormat is the version of the on-disk model format written by saveModel.
+// Bump it whenever a change would make older binaries misread new artifacts.
+// Format 2 added the evaluation; loadModel still reads format 1.
+const artifactFormat = 2
+
+// Model is a trained predictor together with the metadata needed to serve,
+// describe and reproduce it.
+type Model struct {
+    Predictor
+    Algorithm string
+    Params    Params
+    // Version identifies the learned parameters. Models with the same
+    // algorithm, hyperparameters and weights have the same version.
+    Version  string
+    Training TrainingInfo
+    // Evaluation is the model's performance on the rows held out from
+    // training, or nil if none were.
+    Evaluation *Evaluation
+}
+
+// TrainingInfo records how a model was trained.
+type TrainingInfo struct {
+    TrainedAt   time.Time `json:"trained_at"`
+    Duration    float64   `json:"duration_seconds"`
+    Rows        int       `json:"rows"`
+    TestRows    int       `json:"test_rows,omitempty"`
+    DatasetHash string    `json:"dataset_hash"`
+    Seed        int64     `json:"seed"`
+}
+
+// artifact is the on-disk form of a Model. Model holds the predictor's own
+// JSON encoding; the schema is repeated at the top level so tools can read
+// the features and classes without knowing the algorithm's weight layout.
+type artifact struct {
+    Format     int             `json:"format"`
+    Algorithm  string          `json:"algorithm"`
+    Params     Params          `json:"params,omitempty"`
+    Version    string          `json:"version"`
+    Schema     Schema          `json:"schema"`
+    Training   TrainingInfo    `json:"training"`
+    Evaluation *Evaluation     `json:"evaluation,omitempty"`
+    Model      json.RawMessage `json:"model"`
+    // Checksum is the SHA-256 of the artifact's compact JSON encoding with
+    // Checksum itself empty.
+    Checksum string `json:"checksum"`
+}
+
+// sum returns the checksum of a.
+func (a artifact) sum() (string, error) {
+    a.Checksum = ""
+    data, err := json.Marshal(a)
+    if err != nil {
+        return "", err
+    }
+    h := sha256.Sum256(data)
+    return hex.EncodeToString(h[:]), nil
+}
+
+// modelVersion derives a model version from its algorithm, hyperparameters
+// and encoded weights.
+func modelVersion(algorithm string, params Params, weights []byte) (string, error) {
+    p, err := json.Marshal(params)
+    if err != nil {
+        return "", err
+    }
+    h := sha256.New()
+    for _, part := range [][]byte{[]byte(algorithm), p, weights} {
+        h.Write(part)
+        h.Write([]byte{0})
+    }
+    return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// newModel wraps a trained predictor, computing its version.
+func newModel(p Predictor, algorithm string, params Params, info TrainingInfo) (*Model, error) {
+    weights, err := json.Marshal(p)
+    if err != nil {
+        return nil, fmt.Errorf("encoding %s model: %w", algorithm, err)
+    }
+    version, err := modelVersion(algorithm, params, weights)
+    if err != nil {
+        return nil, err
+    }
+    return &Model{Predictor: p, Algorithm: algorithm, Params: params, Version: version, Training: info}, nil
+}
+
+// saveModel writes m to path as a versioned artifact. The file is replaced
+// atomically, so a concurrent loadModel never sees a partial write.
+func saveModel(m *Model, path string) error {
+    weights, err := json.Marshal(m.Predictor)
+    if err != nil {
+        return fmt.Errorf("encoding %s model: %w", m.Algorithm, err)
+    }
+    a := artifact{
+        Format:     artifactFormat,
+        Algorithm:  m.Algorithm,
+        Params:     m.Params,
+        Version:    m.Version,
+        Schema:     m.Schema(),
+        Training:   m.Training,
+        Evaluation: m.Evaluation,
+        Model:      weights,
+    }
+    if a.Checksum, err = a.sum(); err != nil {
+        return err
+    }
+    data, err := json.MarshalIndent(a, "", "  ")
+    if err != nil {
+        return err
+    }
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if err := tmp.Chmod(0o644); err != nil {
+        tmp.Close()
+        return err
+    }
+    if _, err := tmp.Write(append(data, '\n')); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// loadModel reads an artifact written by saveModel, verifying its format and checksum.
+func loadModel(path string) (*Model, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var a artifact
+    if err := json.Unmarshal(data, &a); err != nil {
+        return nil, fmt.Errorf("%s: not a model artifact: %w", path, err)
+    }
+    if a.Format < 1 || a.Format > artifactFormat {
+        return nil, fmt.Errorf("%s: unsupported artifact format %d (this build reads format %d)", path, a.Format, artifactFormat)
+    }
+    sum, err := a.sum()
+    if err != nil {
+        return nil, err
+    }
+    if sum != a.Checksum {
+        return nil, fmt.Errorf("%s: checksum mismatch, the artifact is corrupt or was edited", path)
+    }
+    p, err := newPredictor(a.Algorithm, a.Params)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    if err := json.Unmarshal(a.Model, p); err != nil {
+        return nil, fmt.Errorf("%s: decoding %s model: %w", path, a.Algorithm, err)
+    }
+    return &Model{Predictor: p, Algorithm: a.Algorithm, Params: a.Params, Version: a.Version, Training: a.Training, Evaluation: a.Evaluation}, nil
+}
+
+// hash returns a SHA-256 fingerprint of the dataset's columns, classes and values.
+func (ds *Dataset) hash() string {
+    h := sha256.New()
+    for _, names := range [][]string{ds.Features, ds.Classes} {
+        for _, name := range names {
+            h.Write([]byte(name))
+            h.Write([]byte{0})
+        }
+        h.Write([]byte{0})
+    }
+    var buf [8]byte
+    for i, row := range ds.X {
+        for _, v := range row {
+            binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+            h.Write(buf[:])
+        }
+        binary.LittleEndian.PutUint64(buf[:], uint64(ds.Y[i]))
+        h.Write(buf[:])
+    }
+    return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "math/rand"
+    "os"
+    "sync"
+    "time"
+)
+
+// auditBuffer is how many records can wait to be written before new ones are dropped.
+const auditBuffer = 10000
+
+// auditFlushInterval bounds how long a record can sit in the write buffer.
+const auditFlushInterval = time.Second
+
+// AuditRecord is one line of the prediction audit log.
+type AuditRecord struct {
+    Time          time.Time          `json:"time"`
+    RequestID     string             `json:"request_id"`
+    Row           *int               `json:"row,omitempty"`
+    Input         []float64          `json:"input"`
+    Output        int                `json:"output"`
+    Label         string             `json:"label"`
+    Probabilities map[string]float64 `json:"probabilities"`
+    Algorithm     string             `json:"algorithm"`
+    ModelVersion  string             `json:"model_version"`
+    LatencyMS     float64            `json:"latency_ms"`
+}
+
+var auditDropped = newMetric("model_audit_records_dropped_total", "counter",
+    "Audit records dropped because the writer could not keep up.")
+
+// audit is the prediction audit log, or nil if auditing is disabled.
+var audit *auditLog
+
+// auditLog appends sampled prediction records to a JSON lines file from a
+// background goroutine, so writing never blocks a prediction. The file is
+// rotated when it would grow past maxBytes, keeping up to backups old files
+// named path.1 (newest) to path.N.
+type auditLog struct {
+    path       string
+    maxBytes   int64
+    backups    int
+    sampleRate float64
+
+    // mu guards closed, so that record never sends on records after close
+    // has closed it. Handlers that outlive the shutdown drain can still
+    // call record.
+    mu      sync.RWMutex
+    closed  bool
+    records chan AuditRecord
+    done    chan struct{}
+    file    *os.File
+    w       *bufio.Writer
+    size    int64
+}
+
+// openAuditLog opens path for appending and starts the writer goroutine.
+func openAuditLog(path string, maxBytes int64, backups int, sampleRate float64) (*auditLog, error) {
+    a := &auditLog{
+        path:       path,
+        maxBytes:   maxBytes,
+        backups:    backups,
+        sampleRate: sampleRate,
+        records:    make(chan AuditRecord, auditBuffer),
+        done:       make(chan struct{}),
+    }
+    if err := a.open(); err != nil {
+        return nil, err
+    }
+    go a.run()
+    return a, nil
+}
+
+// record queues rec to be written, subject to sampling. If the queue is full
+// the record is dropped and counted rather than waiting. Records arriving
+// after close are discarded. It is safe to call on a nil *auditLog.
+func (a *auditLog) record(rec AuditRecord) {
+    if a == nil || (a.sampleRate < 1 && rand.Float64() >= a.sampleRate) {
+        return
+    }
+    a.mu.RLock()
+    defer a.mu.RUnlock()
+    if a.closed {
+        return
+    }
+    select {
+    case a.records <- rec:
+    default:
+        auditDropped.inc()
+    }
+}
+
+// close stops accepting records, writes every queued record, flushes and
+// closes the file.
+func (a *auditLog) close() {
+    a.mu.Lock()
+    if !a.closed {
+        a.closed = true
+        close(a.records)
+    }
+    a.mu.Unlock()
+    <-a.done
+}
+
+func (a *auditLog) run() {
+    defer close(a.done)
+    ticker := time.NewTicker(auditFlushInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case rec, ok := <-a.records:
+            if !ok {
+                a.flush()
+                a.file.Close()
+                return
+            }
+            if err := a.write(rec); err != nil {
+                slog.Error("writing audit log", "path", a.path, "error", err)
+            }
+        case <-ticker.C:
+            a.flush()
+        }
+    }
+}
+
+func (a *auditLog) write(rec AuditRecord) error {
+    line, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    line = append(line, '\n')
+    if a.maxBytes > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+        if err := a.rotate(); err != nil {
+            return err
+        }
+    }
+    n, err := a.w.Write(line)
+    a.size += int64(n)
+    return err
+}
+
+func (a *auditLog) flush() {
+    if err := a.w.Flush(); err != nil {
+        slog.Error("flushing audit log", "path", a.path, "error", err)
+    }
+}
+
+func (a *auditLog) open() error {
+    f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return err
+    }
+    info, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return err
+    }
+    a.file, a.w, a.size = f, bufio.NewWriter(f), info.Size()
+    return nil
+}
+
+// rotate shifts path.N-1 to path.N and so on down to path to path.1, drops
+// the oldest file, and reopens path empty.
+func (a *auditLog) rotate() error {
+    if err := a.w.Flush(); err != nil {
+        return err
+    }
+    if err := a.file.Close(); err != nil {
+        return err
+    }
+    if a.backups == 0 {
+        os.Remove(a.path)
+    }
+    for i := a.backups; i >= 1; i-- {
+        src := a.path
+        if i > 1 {
+            src = fmt.Sprintf("%s.%d", a.path, i-1)
+        }
+        if err := os.Rename(src, fmt.Sprintf("%s.%d", a.path, i)); err != nil && !os.IsNotExist(err) {
+            return err
+        }
+    }
+    return a.open()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "mime"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// maxNDJSONLine is the longest NDJSON input row batchHandler accepts.
+const maxNDJSONLine = 1 << 20
+
+// maxBatchBody is the largest JSON matrix body batchHandler accepts, in
+// bytes. NDJSON bodies are streamed and only limited per line.
+const maxBatchBody = 32 << 20
+
+// BatchItem is one row of a batch response: the prediction for the row, or
+// the reason it could not be scored. Row is the position of the row in the
+// request, starting at 0.
+type BatchItem struct {
+    Row int `json:"row"`
+    *Prediction
+    Error      string      `json:"error,omitempty"`
+    Violations []Violation `json:"violations,omitempty"`
+}
+
+// BatchResponse is the response to a JSON matrix posted to /predict/batch.
+type BatchResponse struct {
+    Predictions []BatchItem `json:"predictions"`
+}
+
+// scoreRow decodes and scores one row of a batch. Errors are reported in the
+// item rather than returned, so one bad row does not fail the batch.
+func scoreRow(model *Model, requestID string, row int, raw []byte, minimal bool) BatchItem {
+    start := time.Now()
+    input, err := decodeInput(raw, model.Schema())
+    var verr *ValidationError
+    if errors.As(err, &verr) {
+        recordViolations(verr.Violations)
+        return BatchItem{Row: row, Error: "input does not match the model schema", Violations: verr.Violations}
+    }
+    if err != nil {
+        return BatchItem{Row: row, Error: "invalid input: " + err.Error()}
+    }
+    p, err := model.predict(input)
+    if err != nil {
+        return BatchItem{Row: row, Error: "invalid input: " + err.Error()}
+    }
+    predictionsTotal.inc(p.Label)
+    audit.record(model.auditRecord(requestID, &row, p, time.Since(start)))
+    if minimal {
+        p = p.minimal()
+    }
+    return BatchItem{Row: row, Prediction: &p}
+}
+
+// batchHandler scores many rows per request. The body is either a JSON array
+// of rows, answered with a BatchResponse, or newline-delimited JSON (one row
+// per line, Content-Type application/x-ndjson), answered with one BatchItem
+// per line as each row is scored.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+    model := readyModel(w)
+    if model == nil {
+        return
+    }
+    minimal, _ := strconv.ParseBool(r.URL.Query().Get("minimal"))
+    if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-ndjson" {
+        streamBatch(w, r, model, minimal)
+        return
+    }
+
+    var rows []json.RawMessage
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&rows); err != nil {
+        if bodyTooLarge(w, err) {
+            return
+        }
+        http.Error(w, "Invalid input: want a JSON array of rows", http.StatusBadRequest)
+        return
+    }
+    response := BatchResponse{Predictions: make([]BatchItem, len(rows))}
+    for i, raw := range rows {
+        response.Predictions[i] = scoreRow(model, requestIDFrom(r.Context()), i, raw, minimal)
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
+
+// streamBatch scores an NDJSON body line by line, so arbitrarily large
+// batches are never held in memory. Blank lines are skipped. Results are
+// flushed while the body is still being read, which HTTP/1.x only allows in
+// full-duplex mode.
+func streamBatch(w http.ResponseWriter, r *http.Request, model *Model, minimal bool) {
+    rc := http.NewResponseController(w)
+    rc.EnableFullDuplex()
+    w.Header().Set("Content-Type", "application/x-ndjson")
+    scanner := bufio.NewScanner(r.Body)
+    scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+    enc := json.NewEncoder(w)
+    row := 0
+    for scanner.Scan() {
+        line := scanner.Bytes()
+        if len(line) == 0 {
+            continue
+        }
+        enc.Encode(scoreRow(model, requestIDFrom(r.Context()), row, line, minimal))
+        row++
+        if row%100 == 0 {
+            rc.Flush()
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        enc.Encode(BatchItem{Row: row, Error: "reading input: " + err.Error()})
+    }
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "slices"
+)
+
+func init() {
+    registerModel("gaussian_nb", newGaussianNB)
+    registerModel("multinomial_nb", newMultinomialNB)
+}
+
+// gaussianNB is a Gaussian naive Bayes classifier: within each class every
+// feature is modeled as an independent normal distribution.
+type gaussianNB struct {
+    Spec Schema `json:"schema"`
+    // Counts is the number of training rows of each class; the class priors
+    // are their shares.
+    Counts []float64   `json:"counts"`
+    Mean   [][]float64 `json:"mean"`
+    Var    [][]float64 `json:"var"`
+
+    varSmoothing float64
+}
+
+func newGaussianNB(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &gaussianNB{varSmoothing: r.float("var_smoothing", 1e-9)}
+    r.check("var_smoothing", m.varSmoothing >= 0, "non-negative")
+    return m, r.done()
+}
+
+func (m *gaussianNB) Schema() Schema {
+    return m.Spec
+}
+
+// Fit estimates each class's feature means and variances in one pass over
+// the rows, using Welford's update so that features with a large offset keep
+// their precision. var_smoothing times the largest feature variance is added
+// to every variance, so constant features do not divide by zero.
+func (m *gaussianNB) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    m.Spec = ds.schema()
+    k, d := len(ds.Classes), len(ds.Features)
+    m.Counts = make([]float64, k)
+    m.Mean, m.Var = make([][]float64, k), make([][]float64, k)
+    for c := range m.Mean {
+        m.Mean[c], m.Var[c] = make([]float64, d), make([]float64, d)
+    }
+    // Until the last step, Var holds each feature's sum of squared
+    // differences from the running mean.
+    for i, row := range ds.X {
+        c := ds.Y[i]
+        m.Counts[c]++
+        for j, v := range row {
+            delta := v - m.Mean[c][j]
+            m.Mean[c][j] += delta / m.Counts[c]
+            m.Var[c][j] += delta * (v - m.Mean[c][j])
+        }
+    }
+    _, std := columnStats(ds.X)
+    var maxVar float64
+    for _, s := range std {
+        maxVar = math.Max(maxVar, s*s)
+    }
+    epsilon := m.varSmoothing * maxVar
+    for c := range m.Mean {
+        for j := range m.Mean[c] {
+            if m.Counts[c] > 0 {
+                m.Var[c][j] /= m.Counts[c]
+            }
+            m.Var[c][j] += epsilon
+            if m.Var[c][j] == 0 {
+                m.Var[c][j] = math.SmallestNonzeroFloat64
+            }
+        }
+    }
+    return nil
+}
+
+func (m *gaussianNB) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+func (m *gaussianNB) PredictProba(input []float64) ([]float64, error) {
+    if m.Counts == nil {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    return naiveBayesProba(m.Counts, func(c int) float64 {
+        var ll float64
+        for j, v := range input {
+            diff := v - m.Mean[c][j]
+            ll -= 0.5 * (math.Log(2*math.Pi*m.Var[c][j]) + diff*diff/m.Var[c][j])
+        }
+        return ll
+    }), nil
+}
+
+// multinomialNB is a multinomial naive Bayes classifier for count features,
+// such as word counts: each class is a distribution over the features, and a
+// row is scored by how likely its counts are under it.
+type multinomialNB struct {
+    Spec   Schema    `json:"schema"`
+    Counts []float64 `json:"counts"`
+    // FeatureLogProb is the log probability of each feature within each
+    // class, smoothed with alpha.
+    FeatureLogProb [][]float64 `json:"feature_log_prob"`
+
+    alpha float64
+}
+
+func newMultinomialNB(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &multinomialNB{alpha: r.float("alpha", 1)}
+    r.check("alpha", m.alpha >= 0, "non-negative")
+    return m, r.done()
+}
+
+func (m *multinomialNB) Schema() Schema {
+    return m.Spec
+}
+
+// Fit sums each class's feature counts in one pass over the rows and applies
+// Laplace (add-alpha) smoothing, so features never seen in a class do not
+// rule it out.
+func (m *multinomialNB) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    m.Spec = ds.schema()
+    k, d := len(ds.Classes), len(ds.Features)
+    m.Counts = make([]float64, k)
+    totals := make([][]float64, k)
+    for c := range totals {
+        totals[c] = make([]float64, d)
+    }
+    for i, row := range ds.X {
+        c := ds.Y[i]
+        m.Counts[c]++
+        for j, v := range row {
+            if v < 0 {
+                return fmt.Errorf("row %d: feature %s is %v; multinomial naive Bayes needs non-negative counts", i+1, ds.Features[j], v)
+            }
+            totals[c][j] += v
+        }
+    }
+    m.FeatureLogProb = make([][]float64, k)
+    for c, t := range totals {
+        var sum float64
+        for _, v := range t {
+            sum += v + m.alpha
+        }
+        m.FeatureLogProb[c] = make([]float64, d)
+        for j, v := range t {
+            if sum == 0 {
+                // With alpha 0, a class with no rows or only all-zero rows
+                // says nothing about the features; spread it evenly rather
+                // than dividing zero by zero.
+                m.FeatureLogProb[c][j] = -math.Log(float64(d))
+                continue
+            }
+            // With alpha 0 an unseen feature has probability zero. Use the
+            // most negative finite log so the artifact stays valid JSON.
+            m.FeatureLogProb[c][j] = math.Max(math.Log((v+m.alpha)/sum), -math.MaxFloat64)
+        }
+    }
+    return nil
+}
+
+func (m *multinomialNB) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+func (m *multinomialNB) PredictProba(input []float64) ([]float64, error) {
+    if m.Counts == nil {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    for j, v := range input {
+        if v < 0 {
+            return nil, fmt.Errorf("feature %s is %v; counts must not be negative", m.Spec.Features[j].Name, v)
+        }
+    }
+    return naiveBayesProba(m.Counts, func(c int) float64 {
+        var ll float64
+        for j, v := range input {
+            if v != 0 {
+                ll += v * m.FeatureLogProb[c][j]
+            }
+        }
+        return ll
+    }), nil
+}
+
+// naiveBayesProba turns per-class log-likelihoods into class probabilities.
+// Each class's joint log probability is its log prior plus logLikelihood(c),
+// and the probabilities are normalized in log space so that inputs far from
+// every class do not underflow to zero. Classes with no training rows get
+// probability zero.
+func naiveBayesProba(counts []float64, logLikelihood func(c int) float64) []float64 {
+    var total float64
+    for _, n := range counts {
+        total += n
+    }
+    joint := make([]float64, len(counts))
+    for c, n := range counts {
+        joint[c] = math.Inf(-1)
+        if n > 0 {
+            joint[c] = math.Log(n/total) + logLikelihood(c)
+        }
+    }
+    if slices.Max(joint) == math.Inf(-1) {
+        // The input is impossible under every class; fall back to the priors.
+        for c, n := range counts {
+            joint[c] = math.Log(n / total)
+        }
+    }
+    return softmax(joint)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "math"
+    "math/rand"
+    "slices"
+    "sort"
+)
+
+func init() {
+    registerModel("boost", newBoostModel)
+}
+
+// boostModel is a gradient-boosted tree classifier with softmax loss. Each
+// round fits one regression tree per class to the gradient of the loss, with
+// splits chosen from per-feature histograms of binned values.
+type boostModel struct {
+    Spec Schema `json:"schema"`
+    // Init is the starting score of each class: the log of its smoothed
+    // share of the training rows.
+    Init []float64 `json:"init"`
+    // Trees holds one tree per class for every round kept. Leaf values are
+    // already scaled by the learning rate.
+    Trees [][]*regNode `json:"trees"`
+
+    rounds             int
+    learningRate       float64
+    maxDepth           int
+    minSamplesLeaf     int
+    l2                 float64
+    subsample          float64
+    bins               int
+    validationFraction float64
+    earlyStopping      int
+    trainLogger
+}
+
+func newBoostModel(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &boostModel{
+        rounds:             r.int("rounds", 100),
+        learningRate:       r.float("learning_rate", 0.1),
+        maxDepth:           r.int("max_depth", 3),
+        minSamplesLeaf:     r.int("min_samples_leaf", 5),
+        l2:                 r.float("l2", 1),
+        subsample:          r.float("subsample", 1),
+        bins:               r.int("bins", 255),
+        validationFraction: r.float("validation_fraction", 0.1),
+        earlyStopping:      r.int("early_stopping", 10),
+    }
+    r.check("rounds", m.rounds > 0, "positive")
+    r.check("learning_rate", m.learningRate > 0, "positive")
+    r.check("max_depth", m.maxDepth > 0, "positive")
+    r.check("min_samples_leaf", m.minSamplesLeaf >= 1, "at least 1")
+    r.check("l2", m.l2 >= 0, "non-negative")
+    r.check("subsample", m.subsample > 0 && m.subsample <= 1, "in (0, 1]")
+    r.check("bins", m.bins >= 2 && m.bins <= math.MaxUint16, "between 2 and 65535")
+    r.check("validation_fraction", m.validationFraction >= 0 && m.validationFraction < 1, "in [0, 1)")
+    r.check("early_stopping", m.earlyStopping >= 0, "non-negative (0 disables early stopping)")
+    return m, r.done()
+}
+
+func (m *boostModel) Schema() Schema {
+    return m.Spec
+}
+
+// Fit runs up to rounds boosting rounds. Unless early stopping is disabled,
+// validation_fraction of the rows is held out, and training stops once the
+// validation loss has not improved for early_stopping rounds; the model keeps
+// the rounds up to the best validation loss.
+func (m *boostModel) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    m.Spec = ds.schema()
+    train, valid := ds, (*Dataset)(nil)
+    if m.earlyStopping > 0 && m.validationFraction > 0 {
+        train, valid = ds.split(m.validationFraction, rng.Int63())
+        if len(valid.X) == 0 {
+            valid = nil
+        }
+    }
+    n, k := len(train.X), len(ds.Classes)
+
+    counts := make([]float64, k)
+    for _, y := range train.Y {
+        counts[y]++
+    }
+    m.Init = make([]float64, k)
+    for c := range m.Init {
+        m.Init[c] = math.Log((counts[c] + 1) / float64(n+k))
+    }
+    scores := make([][]float64, n)
+    for i := range scores {
+        scores[i] = slices.Clone(m.Init)
+    }
+    var validScores [][]float64
+    if valid != nil {
+        validScores = make([][]float64, len(valid.X))
+        for i := range validScores {
+            validScores[i] = slices.Clone(m.Init)
+        }
+    }
+
+    edges := binEdges(train.X, m.bins)
+    binned := make([][]uint16, n)
+    for i, row := range train.X {
+        binned[i] = make([]uint16, len(row))
+        for j, v := range row {
+            binned[i][j] = uint16(sort.SearchFloat64s(edges[j], v))
+        }
+    }
+
+    m.Trees = nil
+    grad, hess := make([]float64, n), make([]float64, n)
+    all := make([]int, n)
+    for i := range all {
+        all[i] = i
+    }
+    bestLoss, bestRounds := math.Inf(1), 0
+    for round := 0; round < m.rounds; round++ {
+        proba := make([][]float64, n)
+        for i, s := range scores {
+            proba[i] = softmax(slices.Clone(s))
+        }
+        rows := all
+        if m.subsample < 1 {
+            rows = rng.Perm(n)[:max(1, int(m.subsample*float64(n)))]
+            sort.Ints(rows)
+        }
+        trees := make([]*regNode, k)
+        for c := range trees {
+            for i, p := range proba {
+                y := 0.0
+                if train.Y[i] == c {
+                    y = 1
+                }
+                grad[i] = p[c] - y
+                hess[i] = math.Max(p[c]*(1-p[c]), 1e-16)
+            }
+            trees[c] = m.grow(binned, edges, grad, hess, rows, 0)
+            for i, row := range train.X {
+                scores[i][c] += trees[c].value(row)
+            }
+            if valid != nil {
+                for i, row := range valid.X {
+                    validScores[i][c] += trees[c].value(row)
+                }
+            }
+        }
+        m.Trees = append(m.Trees, trees)
+
+        if valid == nil {
+            if m.logEnabled(slog.LevelDebug) {
+                m.log().Debug("boosting round", "round", round+1, "loss", logLoss(scores, train.Y))
+            }
+            continue
+        }
+        loss := logLoss(validScores, valid.Y)
+        if m.logEnabled(slog.LevelDebug) {
+            m.log().Debug("boosting round", "round", round+1, "loss", logLoss(scores, train.Y), "validation_loss", loss)
+        }
+        if loss < bestLoss-1e-12 {
+            bestLoss, bestRounds = loss, len(m.Trees)
+        } else if len(m.Trees)-bestRounds >= m.earlyStopping {
+            break
+        }
+    }
+    if valid != nil {
+        m.log().Info("boosting finished", "rounds", len(m.Trees), "best_round", bestRounds, "validation_loss", bestLoss)
+        m.Trees = m.Trees[:bestRounds]
+    }
+    return nil
+}
+
+// grow fits a regression tree to the gradients of rows by Newton steps: each
+// split maximizes the gain in the second-order approximation of the loss,
+// and each leaf predicts -G/(H+l2) scaled by the learning rate.
+func (m *boostModel) grow(binned [][]uint16, edges [][]float64, grad, hess []float64, rows []int, depth int) *regNode {
+    var g, h float64
+    for _, i := range rows {
+        g += grad[i]
+        h += hess[i]
+    }
+    node := &regNode{Feature: -1, Value: -m.learningRate * g / (h + m.l2)}
+    if depth >= m.maxDepth || len(rows) < 2*m.minSamplesLeaf {
+        return node
+    }
+
+    parent := g * g / (h + m.l2)
+    bestGain, bestFeature, bestBin := 1e-12, -1, 0
+    for j := range edges {
+        nb := len(edges[j]) + 1
+        histG, histH, histN := make([]float64, nb), make([]float64, nb), make([]int, nb)
+        for _, i := range rows {
+            b := binned[i][j]
+            histG[b] += grad[i]
+            histH[b] += hess[i]
+            histN[b]++
+        }
+        var gl, hl float64
+        nl := 0
+        for b := 0; b < nb-1; b++ {
+            gl, hl, nl = gl+histG[b], hl+histH[b], nl+histN[b]
+            nr := len(rows) - nl
+            if nl < m.minSamplesLeaf || nr < m.minSamplesLeaf {
+                continue
+            }
+            gr, hr := g-gl, h-hl
+            gain := gl*gl/(hl+m.l2) + gr*gr/(hr+m.l2) - parent
+            if gain > bestGain {
+                bestGain, bestFeature, bestBin = gain, j, b
+            }
+        }
+    }
+    if bestFeature < 0 {
+        return node
+    }
+
+    var left, right []int
+    for _, i := range rows {
+        if int(binned[i][bestFeature]) <= bestBin {
+            left = append(left, i)
+        } else {
+            right = append(right, i)
+        }
+    }
+    node.Feature, node.Threshold, node.Value = bestFeature, edges[bestFeature][bestBin], 0
+    node.Left = m.grow(binned, edges, grad, hess, left, depth+1)
+    node.Right = m.grow(binned, edges, grad, hess, right, depth+1)
+    return node
+}
+
+// binEdges returns, for each column of x, up to bins-1 increasing thresholds
+// that divide its values into bins of roughly equal size. A value v falls in
+// bin b when it is above edges[b-1] and at most edges[b].
+func binEdges(x [][]float64, bins int) [][]float64 {
+    edges := make([][]float64, len(x[0]))
+    values := make([]float64, len(x))
+    for j := range edges {
+        for i, row := range x {
+            values[i] = row[j]
+        }
+        sort.Float64s(values)
+        distinct := slices.Compact(slices.Clone(values))
+        if len(distinct) <= bins {
+            for b := 0; b+1 < len(distinct); b++ {
+                edges[j] = append(edges[j], midpoint(distinct[b], distinct[b+1]))
+            }
+            continue
+        }
+        for b := 1; b < bins; b++ {
+            lo := values[b*len(values)/bins-1]
+            hi := values[b*len(values)/bins]
+            if lo == hi {
+                // Inside a run of equal values: cut after the run instead.
+                k := sort.SearchFloat64s(values, math.Nextafter(lo, math.Inf(1)))
+                if k == len(values) {
+                    continue
+                }
+                hi = values[k]
+            }
+            e := midpoint(lo, hi)
+            if len(edges[j]) == 0 || e > edges[j][len(edges[j])-1] {
+                edges[j] = append(edges[j], e)
+            }
+        }
+    }
+    return edges
+}
+
+// logLoss returns the mean cross-entropy of the softmax of scores against y.
+func logLoss(scores [][]float64, y []int) float64 {
+    var sum float64
+    for i, s := range scores {
+        p := softmax(slices.Clone(s))
+        sum -= math.Log(math.Max(p[y[i]], 1e-15))
+    }
+    return sum / float64(len(scores))
+}
+
+func (m *boostModel) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+// PredictProba returns the softmax of each class's starting score plus the
+// values of its trees.
+func (m *boostModel) PredictProba(input []float64) ([]float64, error) {
+    if m.Init == nil {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    scores := slices.Clone(m.Init)
+    for _, trees := range m.Trees {
+        for c, tree := range trees {
+            scores[c] += tree.value(input)
+        }
+    }
+    return softmax(scores), nil
+}
+
+// regNode is a node of a regression tree. Inner nodes send inputs whose
+// Feature is at most Threshold to Left and the rest to Right; leaves predict
+// Value.
+type regNode struct {
+    Feature   int      `json:"feature"`
+    Threshold float64  `json:"threshold,omitempty"`
+    Left      *regNode `json:"left,omitempty"`
+    Right     *regNode `json:"right,omitempty"`
+    Value     float64  `json:"value,omitempty"`
+}
+
+// value returns the value of the leaf input falls into.
+func (n *regNode) value(input []float64) float64 {
+    for n.Left != nil {
+        if input[n.Feature] <= n.Threshold {
+            n = n.Left
+        } else {
+            n = n.Right
+        }
+    }
+    return n.Value
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// command is a subcommand of the binary.
+type command struct {
+    name    string
+    summary string
+    run     func(args []string) error
+}
+
+// commands lists the subcommands in the order usage shows them. serve is the
+// default when no subcommand is given.
+var commands []command
+
+func init() {
+    commands = []command{
+        {"serve", "load or train a model and serve predictions over HTTP (default)", runServe},
+        {"train", "fit a model and write it to an artifact", runTrain},
+        {"tune", "cross-validate a hyperparameter search and train the best candidate", runTune},
+        {"evaluate", "report how well an artifact scores on a labeled CSV file", runEvaluate},
+        {"predict", "score CSV or NDJSON rows from a file or stdin offline", runPredict},
+        {"export", "write a tree model as text rules or a Graphviz DOT graph", runExport},
+        {"replay", "re-score a captured audit log against an artifact", runReplay},
+        {"help", "show this help", func([]string) error { usage(); return nil }},
+    }
+}
+
+func findCommand(name string) (command, bool) {
+    for _, c := range commands {
+        if c.name == name {
+            return c, true
+        }
+    }
+    return command{}, false
+}
+
+// usage prints the list of subcommands to stderr.
+func usage() {
+    fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+    for _, c := range commands {
+        fmt.Fprintf(os.Stderr, "  %-9s %s\n", c.name, c.summary)
+    }
+    fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// runTrain implements the train command.
+func runTrain(args []string) error {
+    cfg, err := commandConfig("train", "train -model artifact [flags]",
+        "Trains a model on -data (default: the embedded Iris dataset) and writes it to -model.", args, false)
+    if err != nil {
+        return err
+    }
+    if cfg.ModelPath == "" {
+        return fmt.Errorf("-model is required")
+    }
+    m, err := trainFromConfig(cfg)
+    if err != nil {
+        return err
+    }
+    if err := saveModel(m, cfg.ModelPath); err != nil {
+        return err
+    }
+    fmt.Printf("wrote %s model %s to %s\n", m.Algorithm, m.Version, cfg.ModelPath)
+    if m.Evaluation != nil {
+        fmt.Printf("\nEvaluation on %d held-out rows\n", m.Evaluation.Rows)
+        m.Evaluation.print(os.Stdout)
+    }
+    return nil
+}
+
+// runEvaluate implements the evaluate command.
+func runEvaluate(args []string) error {
+    fs := flag.NewFlagSet("evaluate", flag.ExitOnError)
+    modelPath := fs.String("model", "", "model artifact to evaluate (required)")
+    dataPath := fs.String("data", "", "labeled CSV file with the model's feature columns (default: print the evaluation stored in the artifact)")
+    label := fs.String("label", "", "name of the class column (default: the last column)")
+    asJSON := fs.Bool("json", false, "print the report as JSON")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s evaluate -model artifact [-data file.csv] [flags]\n\n", os.Args[0])
+        fmt.Fprintf(fs.Output(), "Scores the model on a labeled CSV file and reports accuracy, per-class precision, recall\nand F1, and the confusion matrix.\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if *modelPath == "" {
+        fs.Usage()
+        return fmt.Errorf("-model is required")
+    }
+    m, err := loadModel(*modelPath)
+    if err != nil {
+        return err
+    }
+    e, source := m.Evaluation, "held-out rows"
+    if *dataPath != "" {
+        ds, err := loadCSVFile(*dataPath, csvOptions{Label: *label, Features: featureNames(m.Schema())})
+        if err != nil {
+            return err
+        }
+        if e, err = m.evaluate(ds); err != nil {
+            return err
+        }
+        source = *dataPath
+    } else if e == nil {
+        return fmt.Errorf("%s has no stored evaluation; give -data to evaluate it", *modelPath)
+    }
+
+    if *asJSON {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        return enc.Encode(e)
+    }
+    fmt.Printf("Evaluated %s model %s on %s\n", m.Algorithm, m.Version, source)
+    e.print(os.Stdout)
+    return nil
+}
+
+// runExport implements the export command.
+func runExport(args []string) error {
+    fs := flag.NewFlagSet("export", flag.ExitOnError)
+    modelPath := fs.String("model", "", "model artifact to export (required)")
+    format := fs.String("format", "text", "output format: text for if/else rules, dot for a Graphviz graph")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s export -model artifact [-format text|dot]\n\n", os.Args[0])
+        fmt.Fprintf(fs.Output(), "Writes the learned tree of a tree model to stdout. Render DOT output with\n'dot -Tsvg tree.dot -o tree.svg'.\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if *modelPath == "" {
+        fs.Usage()
+        return fmt.Errorf("-model is required")
+    }
+    m, err := loadModel(*modelPath)
+    if err != nil {
+        return err
+    }
+    t, ok := m.Predictor.(treeExporter)
+    if !ok {
+        return fmt.Errorf("%s models cannot be exported, only tree models can", m.Algorithm)
+    }
+    out := bufio.NewWriter(os.Stdout)
+    defer out.Flush()
+    switch *format {
+    case "text":
+        t.writeRules(out)
+    case "dot":
+        t.writeDOT(out)
+    default:
+        return fmt.Errorf("unknown -format %q, want text or dot", *format)
+    }
+    return nil
+}
+
+// runPredict implements the predict command. CSV input is matched to the
+// model's features by header name, so extra columns such as a label are
+// ignored. NDJSON input takes the same rows as /predict. Output is one
+// BatchItem per line, as from /predict/batch with NDJSON input.
+func runPredict(args []string) error {
+    fs := flag.NewFlagSet("predict", flag.ExitOnError)
+    modelPath := fs.String("model", "", "model artifact to score with (required)")
+    inputPath := fs.String("input", "-", "file to score; - reads stdin")
+    format := fs.String("format", "", "input format, csv or ndjson (default: from the -input extension, else ndjson)")
+    minimal := fs.Bool("minimal", false, "only output each row's input and class index")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s predict -model artifact [flags]\n\nScores rows offline and writes one JSON result per line to stdout.\n\n", os.Args[0])
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if *modelPath == "" {
+        fs.Usage()
+        return fmt.Errorf("-model is required")
+    }
+    m, err := loadModel(*modelPath)
+    if err != nil {
+        return err
+    }
+    in := io.Reader(os.Stdin)
+    if *inputPath != "-" {
+        f, err := os.Open(*inputPath)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        in = f
+    }
+    if *format == "" {
+        *format = "ndjson"
+        if strings.EqualFold(filepath.Ext(*inputPath), ".csv") {
+            *format = "csv"
+        }
+    }
+
+    out := bufio.NewWriter(os.Stdout)
+    defer out.Flush()
+    enc := json.NewEncoder(out)
+    switch *format {
+    case "csv":
+        return predictCSV(m, in, enc, *minimal)
+    case "ndjson":
+        scanner := bufio.NewScanner(in)
+        scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+        row := 0
+        for scanner.Scan() {
+            if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+                enc.Encode(scoreRow(m, "", row, line, *minimal))
+                row++
+            }
+        }
+        return scanner.Err()
+    }
+    return fmt.Errorf("unknown -format %q, want csv or ndjson", *format)
+}
+
+// predictCSV scores each CSV record, looking up the model's features by header name.
+func predictCSV(m *Model, in io.Reader, enc *json.Encoder, minimal bool) error {
+    cr := csv.NewReader(in)
+    cr.TrimLeadingSpace = true
+    header, err := cr.Read()
+    if err != nil {
+        return fmt.Errorf("reading csv header: %w", err)
+    }
+    columns := map[string]int{}
+    for i, name := range header {
+        columns[strings.TrimSpace(name)] = i
+    }
+    for row := 0; ; row++ {
+        rec, err := cr.Read()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            enc.Encode(BatchItem{Row: row, Error: err.Error()})
+            continue
+        }
+        // Values that are not JSON numbers, including NaN, Inf and hex
+        // floats that strconv accepts, are passed through as strings so that
+        // validation reports them like any other bad input. Numbers too large
+        // for a float64 are kept so that they are reported as not finite.
+        named := map[string]any{}
+        for _, f := range m.Schema().Features {
+            i, ok := columns[f.Name]
+            if !ok || i >= len(rec) || strings.TrimSpace(rec[i]) == "" {
+                continue
+            }
+            value := strings.TrimSpace(rec[i])
+            if _, err := strconv.ParseFloat(value, 64); (err == nil || errors.Is(err, strconv.ErrRange)) && json.Valid([]byte(value)) {
+                named[f.Name] = json.Number(value)
+            } else {
+                named[f.Name] = value
+            }
+        }
+        raw, err := json.Marshal(named)
+        if err != nil {
+            enc.Encode(BatchItem{Row: row, Error: "encoding row: " + err.Error()})
+            continue
+        }
+        enc.Encode(scoreRow(m, "", row, raw, minimal))
+    }
+}
+
+// featureNames returns the names of the features in s, in input order.
+func featureNames(s Schema) []string {
+    names := make([]string, len(s.Features))
+    for i, f := range s.Features {
+        names[i] = f.Name
+    }
+    return names
+}
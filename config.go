@@ -0,0 +1,364 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Config is the effective configuration of the service. Each setting can
+// come from, in increasing order of precedence: the built-in default, the
+// config file (-config or MODEL_CONFIG), a MODEL_* environment variable, and
+// a command-line flag.
+type Config struct {
+    Addr            string   `json:"addr"`
+    ModelPath       string   `json:"model"`
+    Train           bool     `json:"train"`
+    Algorithm       string   `json:"algorithm"`
+    Params          Params   `json:"params"`
+    DataPath        string   `json:"data"`
+    Label           string   `json:"label"`
+    Features        []string `json:"features"`
+    RangeMargin     float64  `json:"range_margin"`
+    FillMissing     bool     `json:"fill_missing"`
+    Seed            int64    `json:"seed"`
+    TestFraction    float64  `json:"test_fraction"`
+    ReadTimeout     duration `json:"read_timeout"`
+    WriteTimeout    duration `json:"write_timeout"`
+    ShutdownTimeout duration `json:"shutdown_timeout"`
+    LogLevel        string   `json:"log_level"`
+    AuditPath       string   `json:"audit_path"`
+    AuditMaxBytes   int      `json:"audit_max_bytes"`
+    AuditBackups    int      `json:"audit_backups"`
+    AuditSampleRate float64  `json:"audit_sample_rate"`
+    // Search is only read from the config file, by the tune command.
+    Search *SearchConfig `json:"search,omitempty"`
+}
+
+// defaultConfig returns the configuration used when nothing is overridden.
+func defaultConfig() *Config {
+    return &Config{
+        Addr:            ":8080",
+        Algorithm:       "logistic",
+        Params:          Params{},
+        RangeMargin:     0.1,
+        Seed:            1,
+        TestFraction:    0.2,
+        ReadTimeout:     duration(time.Minute),
+        WriteTimeout:    duration(5 * time.Minute),
+        ShutdownTimeout: duration(20 * time.Second),
+        LogLevel:        "info",
+        AuditPath:       "requests.jsonl",
+        AuditMaxBytes:   100 << 20,
+        AuditBackups:    5,
+        AuditSampleRate: 1,
+    }
+}
+
+// duration is a time.Duration that reads and writes JSON as a string like "20s".
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil {
+        return fmt.Errorf("duration must be a string like \"20s\"")
+    }
+    v, err := time.ParseDuration(s)
+    *d = duration(v)
+    return err
+}
+
+// setting is one configuration value that can be set from a flag and an
+// environment variable. The config file sets the same values by JSON key.
+type setting struct {
+    name      string // flag name
+    env       string // environment variable
+    usage     string
+    isBool    bool
+    serveOnly bool // only meaningful to the serve command
+    set       func(c *Config, value string) error
+}
+
+// serveOnly marks s as a setting that only the serve command uses.
+func serveOnly(s setting) setting {
+    s.serveOnly = true
+    return s
+}
+
+// settings lists every configuration value settable from the command line
+// and environment, in the order they are documented.
+var settings = []setting{
+    serveOnly(stringSetting("addr", "MODEL_ADDR", "address to listen on", func(c *Config) *string { return &c.Addr })),
+    stringSetting("model", "MODEL_PATH", "model artifact: serve loads it instead of training unless -train is set, train writes it", func(c *Config) *string { return &c.ModelPath }),
+    serveOnly(boolSetting("train", "MODEL_TRAIN", "train a model on startup even if -model is set, and save it to -model", func(c *Config) *bool { return &c.Train })),
+    stringSetting("algorithm", "MODEL_ALGORITHM", "model to train", func(c *Config) *string { return &c.Algorithm }),
+    {name: "param", env: "MODEL_PARAMS", usage: "model hyperparameters as name=value, comma-separated or repeated, e.g. learning_rate=0.05", set: func(c *Config, v string) error {
+        if c.Params == nil {
+            c.Params = Params{}
+        }
+        for _, pair := range strings.Split(v, ",") {
+            if err := setParam(c.Params, strings.TrimSpace(pair)); err != nil {
+                return err
+            }
+        }
+        return nil
+    }},
+    stringSetting("data", "MODEL_DATA", "CSV file to train on, with a header row (default: the embedded Iris dataset)", func(c *Config) *string { return &c.DataPath }),
+    stringSetting("label", "MODEL_LABEL", "name of the class column in the training data (default: the last column)", func(c *Config) *string { return &c.Label }),
+    {name: "features", env: "MODEL_FEATURES", usage: "comma-separated feature columns in the training data (default: every column but the label)", set: func(c *Config, v string) error {
+        c.Features = nil
+        if v != "" {
+            c.Features = strings.Split(v, ",")
+        }
+        return nil
+    }},
+    floatSetting("range-margin", "MODEL_RANGE_MARGIN", "widen each feature's allowed input range beyond the training data by this fraction of its span; negative disables range checks", func(c *Config) *float64 { return &c.RangeMargin }),
+    boolSetting("fill-missing", "MODEL_FILL_MISSING", "let named-feature inputs leave features out, filling them with the training mean", func(c *Config) *bool { return &c.FillMissing }),
+    {name: "seed", env: "MODEL_SEED", usage: "random seed for training; the same seed always yields the same model", set: func(c *Config, v string) error {
+        seed, err := strconv.ParseInt(v, 10, 64)
+        c.Seed = seed
+        return err
+    }},
+    floatSetting("test-fraction", "MODEL_TEST_FRACTION", "fraction of each class held out of training to evaluate the model on; 0 trains on every row", func(c *Config) *float64 { return &c.TestFraction }),
+    serveOnly(durationSetting("read-timeout", "MODEL_READ_TIMEOUT", "maximum time to read a request, including the body", func(c *Config) *duration { return &c.ReadTimeout })),
+    serveOnly(durationSetting("write-timeout", "MODEL_WRITE_TIMEOUT", "maximum time to write a response, including streamed batches", func(c *Config) *duration { return &c.WriteTimeout })),
+    serveOnly(durationSetting("shutdown-timeout", "MODEL_SHUTDOWN_TIMEOUT", "how long to let in-flight requests finish after SIGTERM before closing them", func(c *Config) *duration { return &c.ShutdownTimeout })),
+    stringSetting("log-level", "MODEL_LOG_LEVEL", "minimum log level: debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+    serveOnly(stringSetting("audit-path", "MODEL_AUDIT_PATH", "JSON lines file every prediction is appended to; empty disables the audit log", func(c *Config) *string { return &c.AuditPath })),
+    serveOnly(intSetting("audit-max-bytes", "MODEL_AUDIT_MAX_BYTES", "rotate the audit log when it would grow past this size; 0 never rotates", func(c *Config) *int { return &c.AuditMaxBytes })),
+    serveOnly(intSetting("audit-backups", "MODEL_AUDIT_BACKUPS", "number of rotated audit logs to keep", func(c *Config) *int { return &c.AuditBackups })),
+    serveOnly(floatSetting("audit-sample-rate", "MODEL_AUDIT_SAMPLE_RATE", "fraction of predictions written to the audit log, between 0 and 1", func(c *Config) *float64 { return &c.AuditSampleRate })),
+}
+
+func stringSetting(name, env, usage string, field func(*Config) *string) setting {
+    return setting{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+        *field(c) = v
+        return nil
+    }}
+}
+
+func boolSetting(name, env, usage string, field func(*Config) *bool) setting {
+    return setting{name: name, env: env, usage: usage, isBool: true, set: func(c *Config, v string) error {
+        b, err := strconv.ParseBool(v)
+        *field(c) = b
+        return err
+    }}
+}
+
+func intSetting(name, env, usage string, field func(*Config) *int) setting {
+    return setting{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+        n, err := strconv.Atoi(v)
+        *field(c) = n
+        return err
+    }}
+}
+
+func floatSetting(name, env, usage string, field func(*Config) *float64) setting {
+    return setting{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+        f, err := strconv.ParseFloat(v, 64)
+        *field(c) = f
+        return err
+    }}
+}
+
+func durationSetting(name, env, usage string, field func(*Config) *duration) setting {
+    return setting{name: name, env: env, usage: usage, set: func(c *Config, v string) error {
+        d, err := time.ParseDuration(v)
+        *field(c) = duration(d)
+        return err
+    }}
+}
+
+// setParam adds one name=value hyperparameter to params. Values that parse
+// as numbers are stored as numbers.
+func setParam(params Params, s string) error {
+    name, value, ok := strings.Cut(s, "=")
+    if !ok || name == "" {
+        return fmt.Errorf("want name=value, got %q", s)
+    }
+    if f, err := strconv.ParseFloat(value, 64); err == nil {
+        params[name] = f
+    } else {
+        params[name] = value
+    }
+    return nil
+}
+
+// loadConfig builds the effective configuration from defaults, the config
+// file, the environment and the flags in args, registering those flags on fs.
+// Unless serving is set, settings only the server uses get no flag and are
+// not read from the environment.
+func loadConfig(fs *flag.FlagSet, args []string, serving bool) (*Config, error) {
+    defaults := defaultConfig()
+    var configPath string
+    fs.StringVar(&configPath, "config", os.Getenv("MODEL_CONFIG"), "JSON or YAML config file (env MODEL_CONFIG)")
+
+    // Flags are applied last, so record them in order and replay them once
+    // the file and environment have been read.
+    type flagValue struct {
+        s     setting
+        value string
+    }
+    var flags []flagValue
+    defaultValues := configFields(defaults)
+    for _, s := range settings {
+        if s.serveOnly && !serving {
+            continue
+        }
+        usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+        if def := defaultValues[strings.ReplaceAll(s.name, "-", "_")]; def != "" {
+            usage += fmt.Sprintf(" (default %s)", def)
+        }
+        record := func(v string) error {
+            flags = append(flags, flagValue{s, v})
+            return nil
+        }
+        if s.isBool {
+            fs.BoolFunc(s.name, usage, record)
+        } else {
+            fs.Func(s.name, usage, record)
+        }
+    }
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+
+    c := defaults
+    if configPath != "" {
+        if err := readConfigFile(configPath, c); err != nil {
+            return nil, err
+        }
+    }
+    for _, s := range settings {
+        if s.serveOnly && !serving {
+            continue
+        }
+        if v, ok := os.LookupEnv(s.env); ok {
+            if err := s.set(c, v); err != nil {
+                return nil, fmt.Errorf("%s: %w", s.env, err)
+            }
+        }
+    }
+    for _, f := range flags {
+        if err := f.s.set(c, f.value); err != nil {
+            return nil, fmt.Errorf("-%s: %w", f.s.name, err)
+        }
+    }
+    return c, c.validate()
+}
+
+// commandConfig parses the configuration flags of a subcommand. With
+// -print-config it prints the effective configuration as JSON and exits.
+func commandConfig(name, synopsis, description string, args []string, serving bool) (*Config, error) {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    printConfig := fs.Bool("print-config", false, "print the effective configuration as JSON and exit")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s %s\n\n%s\n\n", os.Args[0], synopsis, description)
+        fmt.Fprintf(fs.Output(), "Settings are read from built-in defaults, then the -config file, then MODEL_* environment variables, then flags; later sources win.\nAlgorithms: %s\n\n", strings.Join(modelNames(), ", "))
+        fs.PrintDefaults()
+    }
+    cfg, err := loadConfig(fs, args, serving)
+    if err != nil {
+        return nil, err
+    }
+    if *printConfig {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        enc.Encode(cfg)
+        os.Exit(0)
+    }
+    level, _ := cfg.logLevel()
+    setupLogging(level)
+    return cfg, nil
+}
+
+// configFields returns the non-zero values of c by JSON key, formatted for
+// usage messages.
+func configFields(c *Config) map[string]string {
+    data, _ := json.Marshal(c)
+    var raw map[string]json.RawMessage
+    json.Unmarshal(data, &raw)
+    fields := map[string]string{}
+    for key, v := range raw {
+        switch string(v) {
+        case `""`, "false", "0", "null", "{}":
+        default:
+            fields[key] = strings.Trim(string(v), `"`)
+        }
+    }
+    return fields
+}
+
+// readConfigFile overlays the settings in the JSON or YAML file at path onto c.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func readConfigFile(path string, c *Config) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+        v, err := parseYAML(data)
+        if err != nil {
+            return fmt.Errorf("%s: %w", path, err)
+        }
+        if data, err = json.Marshal(v); err != nil {
+            return fmt.Errorf("%s: %w", path, err)
+        }
+    }
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(c); err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    return nil
+}
+
+// validate checks the settings that cannot be checked where they are used.
+func (c *Config) validate() error {
+    if _, ok := models[c.Algorithm]; !ok {
+        return fmt.Errorf("unknown algorithm %q (available: %s)", c.Algorithm, strings.Join(modelNames(), ", "))
+    }
+    if _, err := c.logLevel(); err != nil {
+        return err
+    }
+    if c.TestFraction < 0 || c.TestFraction >= 1 {
+        return fmt.Errorf("test_fraction must be at least 0 and less than 1")
+    }
+    if c.AuditSampleRate < 0 || c.AuditSampleRate > 1 {
+        return fmt.Errorf("audit_sample_rate must be between 0 and 1")
+    }
+    if c.AuditMaxBytes < 0 || c.AuditBackups < 0 {
+        return fmt.Errorf("audit_max_bytes and audit_backups must not be negative")
+    }
+    if c.Search != nil {
+        if err := c.Search.validate(); err != nil {
+            return err
+        }
+    }
+    for name, d := range map[string]duration{"read_timeout": c.ReadTimeout, "write_timeout": c.WriteTimeout, "shutdown_timeout": c.ShutdownTimeout} {
+        if d < 0 {
+            return fmt.Errorf("%s must not be negative", name)
+        }
+    }
+    return nil
+}
+
+// logLevel parses LogLevel.
+func (c *Config) logLevel() (slog.Level, error) {
+    var level slog.Level
+    if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+        return 0, fmt.Errorf("log_level: %w", err)
+    }
+    return level, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+    "bytes"
+    _ "embed"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Dataset is a labeled table of numeric features. Y holds indices into Classes.
+type Dataset struct {
+    Features []string
+    Classes  []string
+    X        [][]float64
+    Y        []int
+
+    // RangeMargin widens the allowed range of each feature in the schema of
+    // models trained on the dataset by this fraction of the observed range on
+    // each side. Negative values leave the allowed ranges unbounded.
+    RangeMargin float64
+    // FillMissing gives every feature in the schema a default of its
+    // training mean, so named-feature inputs may leave features out.
+    FillMissing bool
+}
+
+// schema returns the Schema of a model trained on ds. A feature is typed as
+// an integer if every training value is integral, and its allowed range is
+// the observed range widened by RangeMargin.
+func (ds *Dataset) schema() Schema {
+    features := make([]Feature, len(ds.Features))
+    for j, name := range ds.Features {
+        lo, hi := math.Inf(1), math.Inf(-1)
+        integral := true
+        var sum float64
+        for _, row := range ds.X {
+            lo, hi = math.Min(lo, row[j]), math.Max(hi, row[j])
+            integral = integral && row[j] == math.Trunc(row[j])
+            sum += row[j]
+        }
+        features[j] = Feature{Name: name, Type: featureNumber}
+        if integral {
+            features[j].Type = featureInteger
+        }
+        if ds.RangeMargin >= 0 && len(ds.X) > 0 {
+            pad := (hi - lo) * ds.RangeMargin
+            lo, hi = lo-pad, hi+pad
+            features[j].Min, features[j].Max = &lo, &hi
+        }
+        if ds.FillMissing && len(ds.X) > 0 {
+            mean := sum / float64(len(ds.X))
+            if integral {
+                mean = math.Round(mean)
+            }
+            features[j].Default = &mean
+        }
+    }
+    return Schema{Features: features, Classes: ds.Classes}
+}
+
+// validate checks that every row has one value per feature and a known class.
+func (ds *Dataset) validate() error {
+    if len(ds.X) == 0 {
+        return fmt.Errorf("dataset is empty")
+    }
+    if len(ds.X) != len(ds.Y) {
+        return fmt.Errorf("dataset has %d rows but %d labels", len(ds.X), len(ds.Y))
+    }
+    for i, row := range ds.X {
+        if len(row) != len(ds.Features) {
+            return fmt.Errorf("row %d has %d values, want %d", i, len(row), len(ds.Features))
+        }
+        if ds.Y[i] < 0 || ds.Y[i] >= len(ds.Classes) {
+            return fmt.Errorf("row %d has class index %d, want 0..%d", i, ds.Y[i], len(ds.Classes)-1)
+        }
+    }
+    return nil
+}
+
+// csvOptions selects which columns of a CSV file are used for training.
+type csvOptions struct {
+    // Label names the class column. Empty means the last column.
+    Label string
+    // Features names the feature columns, in model input order. Empty means
+    // every column except the label, in file order.
+    Features []string
+}
+
+// maxRowErrors caps how many malformed rows loadCSV reports individually.
+const maxRowErrors = 10
+
+// loadCSV reads a labeled dataset from CSV with a header row. Class labels are
+// mapped to indices in sorted order so that the mapping does not depend on the
+// order of rows in the file. Malformed rows are reported with their line numbers.
+func loadCSV(r io.Reader, opts csvOptions) (*Dataset, error) {
+    cr := csv.NewReader(r)
+    cr.TrimLeadingSpace = true
+    header, err := cr.Read()
+    if err == io.EOF {
+        return nil, fmt.Errorf("csv is empty")
+    }
+    if err != nil {
+        return nil, err
+    }
+    columns := map[string]int{}
+    for i, name := range header {
+        name = strings.TrimSpace(name)
+        header[i] = name
+        if _, dup := columns[name]; dup {
+            return nil, fmt.Errorf("line 1: duplicate column %q", name)
+        }
+        columns[name] = i
+    }
+
+    labelCol := len(header) - 1
+    if opts.Label != "" {
+        var ok bool
+        if labelCol, ok = columns[opts.Label]; !ok {
+            return nil, fmt.Errorf("label column %q not in header %v", opts.Label, header)
+        }
+    }
+    var featureCols []int
+    if len(opts.Features) == 0 {
+        for i := range header {
+            if i != labelCol {
+                featureCols = append(featureCols, i)
+            }
+        }
+    }
+    for _, name := range opts.Features {
+        i, ok := columns[name]
+        if !ok {
+            return nil, fmt.Errorf("feature column %q not in header %v", name, header)
+        }
+        if i == labelCol {
+            return nil, fmt.Errorf("column %q cannot be both a feature and the label", name)
+        }
+        featureCols = append(featureCols, i)
+    }
+    if len(featureCols) == 0 {
+        return nil, fmt.Errorf("no feature columns")
+    }
+
+    ds := &Dataset{}
+    for _, i := range featureCols {
+        ds.Features = append(ds.Features, header[i])
+    }
+    var labels []string
+    var rowErrs []error
+    bad := 0
+    for {
+        rec, err := cr.Read()
+        if err == io.EOF {
+            break
+        }
+        var row []float64
+        if err == nil {
+            line, _ := cr.FieldPos(0)
+            if row, err = parseRow(rec, header, featureCols, labelCol); err != nil {
+                err = fmt.Errorf("line %d: %w", line, err)
+            }
+        }
+        if err != nil {
+            bad++
+            if len(rowErrs) < maxRowErrors {
+                rowErrs = append(rowErrs, err)
+            }
+            continue
+        }
+        ds.X = append(ds.X, row)
+        labels = append(labels, strings.TrimSpace(rec[labelCol]))
+    }
+    if bad > len(rowErrs) {
+        rowErrs = append(rowErrs, fmt.Errorf("and %d more malformed rows", bad-len(rowErrs)))
+    }
+    if len(rowErrs) > 0 {
+        return nil, errors.Join(rowErrs...)
+    }
+
+    classes := map[string]int{}
+    for _, label := range labels {
+        classes[label] = 0
+    }
+    for label := range classes {
+        ds.Classes = append(ds.Classes, label)
+    }
+    sort.Strings(ds.Classes)
+    for i, label := range ds.Classes {
+        classes[label] = i
+    }
+    for _, label := range labels {
+        ds.Y = append(ds.Y, classes[label])
+    }
+    return ds, ds.validate()
+}
+
+// parseRow extracts the feature values of one CSV record and checks its label.
+func parseRow(rec, header []string, featureCols []int, labelCol int) ([]float64, error) {
+    if strings.TrimSpace(rec[labelCol]) == "" {
+        return nil, fmt.Errorf("column %s: missing label", header[labelCol])
+    }
+    row := make([]float64, len(featureCols))
+    for j, i := range featureCols {
+        field := strings.TrimSpace(rec[i])
+        if field == "" {
+            return nil, fmt.Errorf("column %s: missing value", header[i])
+        }
+        v, err := strconv.ParseFloat(field, 64)
+        if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+            return nil, fmt.Errorf("column %s: %q is not a finite number", header[i], field)
+        }
+        row[j] = v
+    }
+    return row, nil
+}
+
+// loadCSVFile is loadCSV for a file on disk.
+func loadCSVFile(path string, opts csvOptions) (*Dataset, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    ds, err := loadCSV(f, opts)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return ds, nil
+}
+
+//go:embed data/iris.csv
+var irisCSV []byte
+
+// loadTrainingData reads the CSV dataset at path, or Fisher's Iris dataset
+// if path is empty. Iris is embedded in the binary so the server can train a
+// real classifier without any external files.
+func loadTrainingData(path string, opts csvOptions) (*Dataset, error) {
+    if path != "" {
+        return loadCSVFile(path, opts)
+    }
+    ds, err := loadCSV(bytes.NewReader(irisCSV), opts)
+    if err != nil {
+        return nil, fmt.Errorf("embedded iris.csv: %w", err)
+    }
+    return ds, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "math/rand"
+    "sort"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+)
+
+// Evaluation measures a model's predictions against known labels.
+type Evaluation struct {
+    Rows     int     `json:"rows"`
+    Accuracy float64 `json:"accuracy"`
+    // Classes has one entry per label, in the order of Labels.
+    Classes     []ClassMetrics `json:"classes"`
+    MacroAvg    Averages       `json:"macro_avg"`
+    WeightedAvg Averages       `json:"weighted_avg"`
+    // Labels lists every label seen, actual or predicted, in sorted order.
+    Labels []string `json:"labels"`
+    // Confusion counts rows by actual label, then predicted label, indexed
+    // like Labels.
+    Confusion [][]int `json:"confusion"`
+}
+
+// ClassMetrics is the precision, recall and F1 score of one class.
+type ClassMetrics struct {
+    Label     string  `json:"label"`
+    Precision float64 `json:"precision"`
+    Recall    float64 `json:"recall"`
+    F1        float64 `json:"f1"`
+    Support   int     `json:"support"`
+}
+
+// Averages summarizes ClassMetrics over every class.
+type Averages struct {
+    Precision float64 `json:"precision"`
+    Recall    float64 `json:"recall"`
+    F1        float64 `json:"f1"`
+}
+
+// split divides ds into a training and a test set, holding out fraction of
+// the rows of each class so that both sets keep the class balance of ds.
+// Every class keeps at least one training row. The same seed always gives
+// the same split.
+func (ds *Dataset) split(fraction float64, seed int64) (train, test *Dataset) {
+    rng := rand.New(rand.NewSource(seed))
+    byClass := make([][]int, len(ds.Classes))
+    for i, y := range ds.Y {
+        byClass[y] = append(byClass[y], i)
+    }
+    var trainRows, testRows []int
+    for _, rows := range byClass {
+        rng.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+        n := int(float64(len(rows))*fraction + 0.5)
+        if n >= len(rows) {
+            n = len(rows) - 1
+        }
+        if n < 0 {
+            n = 0
+        }
+        testRows = append(testRows, rows[:n]...)
+        trainRows = append(trainRows, rows[n:]...)
+    }
+    sort.Ints(trainRows)
+    sort.Ints(testRows)
+    return ds.subset(trainRows), ds.subset(testRows)
+}
+
+// subset returns a dataset with the given rows of ds. The rows are shared, not copied.
+func (ds *Dataset) subset(rows []int) *Dataset {
+    sub := &Dataset{Features: ds.Features, Classes: ds.Classes, RangeMargin: ds.RangeMargin, FillMissing: ds.FillMissing}
+    for _, i := range rows {
+        sub.X = append(sub.X, ds.X[i])
+        sub.Y = append(sub.Y, ds.Y[i])
+    }
+    return sub
+}
+
+// evaluate scores every row of ds with m. Labels are compared by name, so ds
+// may have classes the model does not know or lack some that it does.
+func (m *Model) evaluate(ds *Dataset) (*Evaluation, error) {
+    actual := make([]string, len(ds.X))
+    predicted := make([]string, len(ds.X))
+    for i, row := range ds.X {
+        p, err := m.predict(row)
+        if err != nil {
+            return nil, fmt.Errorf("row %d: %w", i+1, err)
+        }
+        actual[i], predicted[i] = ds.Classes[ds.Y[i]], p.Label
+    }
+    return newEvaluation(actual, predicted), nil
+}
+
+// newEvaluation computes an Evaluation from parallel slices of actual and
+// predicted labels.
+func newEvaluation(actual, predicted []string) *Evaluation {
+    index := map[string]int{}
+    for _, labels := range [][]string{actual, predicted} {
+        for _, label := range labels {
+            index[label] = 0
+        }
+    }
+    e := &Evaluation{Rows: len(actual)}
+    for label := range index {
+        e.Labels = append(e.Labels, label)
+    }
+    sort.Strings(e.Labels)
+    for i, label := range e.Labels {
+        index[label] = i
+    }
+    e.Confusion = make([][]int, len(e.Labels))
+    for i := range e.Confusion {
+        e.Confusion[i] = make([]int, len(e.Labels))
+    }
+    correct := 0
+    for i := range actual {
+        e.Confusion[index[actual[i]]][index[predicted[i]]]++
+        if actual[i] == predicted[i] {
+            correct++
+        }
+    }
+    if e.Rows > 0 {
+        e.Accuracy = float64(correct) / float64(e.Rows)
+    }
+
+    for i, label := range e.Labels {
+        c := ClassMetrics{Label: label}
+        hits, predictedAs := e.Confusion[i][i], 0
+        for j := range e.Labels {
+            c.Support += e.Confusion[i][j]
+            predictedAs += e.Confusion[j][i]
+        }
+        if predictedAs > 0 {
+            c.Precision = float64(hits) / float64(predictedAs)
+        }
+        if c.Support > 0 {
+            c.Recall = float64(hits) / float64(c.Support)
+        }
+        if c.Precision+c.Recall > 0 {
+            c.F1 = 2 * c.Precision * c.Recall / (c.Precision + c.Recall)
+        }
+        e.Classes = append(e.Classes, c)
+
+        n, w := float64(len(e.Labels)), float64(c.Support)/float64(e.Rows)
+        e.MacroAvg.Precision += c.Precision / n
+        e.MacroAvg.Recall += c.Recall / n
+        e.MacroAvg.F1 += c.F1 / n
+        e.WeightedAvg.Precision += c.Precision * w
+        e.WeightedAvg.Recall += c.Recall * w
+        e.WeightedAvg.F1 += c.F1 * w
+    }
+    return e
+}
+
+// print writes e as a classification report followed by the confusion matrix.
+func (e *Evaluation) print(out io.Writer) {
+    fmt.Fprintf(out, "Accuracy: %.4f (%d rows)\n\n", e.Accuracy, e.Rows)
+    tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+    fmt.Fprintln(tw, "\tprecision\trecall\tf1\tsupport\t")
+    for _, c := range e.Classes {
+        fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\t\n", c.Label, c.Precision, c.Recall, c.F1, c.Support)
+    }
+    for _, avg := range []struct {
+        name string
+        a    Averages
+    }{{"macro avg", e.MacroAvg}, {"weighted avg", e.WeightedAvg}} {
+        fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\t\n", avg.name, avg.a.Precision, avg.a.Recall, avg.a.F1, e.Rows)
+    }
+    tw.Flush()
+
+    fmt.Fprintf(out, "\nConfusion matrix (rows: actual label, columns: predicted label)\n")
+    tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+    fmt.Fprintf(tw, "\t%s\t\n", strings.Join(e.Labels, "\t"))
+    for i, label := range e.Labels {
+        cells := []string{label}
+        for _, n := range e.Confusion[i] {
+            cells = append(cells, strconv.Itoa(n))
+        }
+        fmt.Fprintf(tw, "%s\t\n", strings.Join(cells, "\t"))
+    }
+    tw.Flush()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "runtime"
+    "sync"
+)
+
+func init() {
+    registerModel("forest", newForestModel)
+}
+
+// forestModel is a random forest: CART trees trained on bootstrap samples of
+// the training rows, each split considering a random subset of the features.
+// Predictions average the trees' class probabilities.
+type forestModel struct {
+    Spec  Schema      `json:"schema"`
+    Trees []*treeNode `json:"trees"`
+    // OOBAccuracy is the out-of-bag estimate of accuracy: each training row
+    // scored only by the trees whose bootstrap sample left it out. OOBRows is
+    // how many rows were left out by at least one tree.
+    OOBAccuracy float64 `json:"oob_accuracy"`
+    OOBRows     int     `json:"oob_rows"`
+
+    trees int
+    cart  cart
+    trainLogger
+}
+
+func newForestModel(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &forestModel{
+        trees: r.int("trees", 100),
+        cart:  readCART(r),
+    }
+    m.cart.maxFeatures = r.int("max_features", 0)
+    r.check("trees", m.trees > 0, "positive")
+    r.check("max_features", m.cart.maxFeatures >= 0, "non-negative (0 means the square root of the number of features)")
+    return m, r.done()
+}
+
+func (m *forestModel) Schema() Schema {
+    return m.Spec
+}
+
+// Fit trains the trees concurrently, one per CPU at a time. Each tree has its
+// own random source seeded from rng, so the forest does not depend on how
+// the trees are scheduled.
+func (m *forestModel) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    m.Spec = ds.schema()
+    c := m.cart
+    if c.maxFeatures == 0 {
+        c.maxFeatures = max(1, int(math.Round(math.Sqrt(float64(len(ds.Features))))))
+    }
+    n := len(ds.X)
+    seeds := make([]int64, m.trees)
+    for t := range seeds {
+        seeds[t] = rng.Int63()
+    }
+    m.Trees = make([]*treeNode, m.trees)
+    inBag := make([][]bool, m.trees)
+
+    jobs := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < min(runtime.GOMAXPROCS(0), m.trees); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for t := range jobs {
+                treeRNG := rand.New(rand.NewSource(seeds[t]))
+                rows := make([]int, n)
+                inBag[t] = make([]bool, n)
+                for i := range rows {
+                    rows[i] = treeRNG.Intn(n)
+                    inBag[t][rows[i]] = true
+                }
+                m.Trees[t] = c.grow(ds, rows, treeRNG)
+            }
+        }()
+    }
+    for t := 0; t < m.trees; t++ {
+        jobs <- t
+    }
+    close(jobs)
+    wg.Wait()
+
+    m.outOfBag(ds, inBag)
+    m.log().Info("out-of-bag estimate", "trees", m.trees, "accuracy", m.OOBAccuracy, "rows", m.OOBRows)
+    return nil
+}
+
+// outOfBag computes the out-of-bag accuracy on ds given which rows each tree
+// was trained on.
+func (m *forestModel) outOfBag(ds *Dataset, inBag [][]bool) {
+    correct := 0
+    m.OOBRows = 0
+    for i, row := range ds.X {
+        votes := make([]float64, len(ds.Classes))
+        scored := false
+        for t, tree := range m.Trees {
+            if inBag[t][i] {
+                continue
+            }
+            scored = true
+            for c, p := range tree.leaf(row).proba() {
+                votes[c] += p
+            }
+        }
+        if !scored {
+            continue
+        }
+        m.OOBRows++
+        if argmax(votes) == ds.Y[i] {
+            correct++
+        }
+    }
+    m.OOBAccuracy = 0
+    if m.OOBRows > 0 {
+        m.OOBAccuracy = float64(correct) / float64(m.OOBRows)
+    }
+}
+
+func (m *forestModel) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+// PredictProba averages the class probabilities of every tree.
+func (m *forestModel) PredictProba(input []float64) ([]float64, error) {
+    if len(m.Trees) == 0 {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    // Sum first and divide once: adding p/len(Trees) per tree accumulates
+    // rounding error and can give probabilities above 1.
+    proba := make([]float64, len(m.Spec.Classes))
+    for _, tree := range m.Trees {
+        for c, p := range tree.leaf(input).proba() {
+            proba[c] += p
+        }
+    }
+    for c := range proba {
+        proba[c] /= float64(len(m.Trees))
+    }
+    return proba, nil
+}
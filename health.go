@@ -0,0 +1,54 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync/atomic"
+)
+
+// retryAfter is how long, in seconds, clients are told to wait while the model is not ready.
+const retryAfter = 5
+
+// current is the model being served. It is nil until loading or training
+// finishes, which happens after the server has started listening.
+var current atomic.Pointer[Model]
+
+// serveModel makes m the model being served and publishes its metrics.
+func serveModel(m *Model) {
+    current.Store(m)
+    modelInfo.reset()
+    modelInfo.set(1, m.Algorithm, m.Version)
+    trainingDuration.set(m.Training.Duration)
+}
+
+// readyModel returns the model being served. If there is none yet it responds
+// with 503 and a Retry-After header, and returns nil.
+func readyModel(w http.ResponseWriter) *Model {
+    m := current.Load()
+    if m == nil {
+        w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+        http.Error(w, "Model is not ready yet", http.StatusServiceUnavailable)
+    }
+    return m
+}
+
+// healthzHandler is the liveness probe: it succeeds as long as the process can serve HTTP.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+    fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler is the readiness probe: it succeeds once a model has been
+// loaded or trained, and fails again as soon as shutdown begins.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+    if draining.Load() {
+        http.Error(w, "not ready: shutting down", http.StatusServiceUnavailable)
+        return
+    }
+    m := current.Load()
+    if m == nil {
+        http.Error(w, "not ready: model is loading or training", http.StatusServiceUnavailable)
+        return
+    }
+    fmt.Fprintf(w, "ready: %s model %s\n", m.Algorithm, m.Version)
+}
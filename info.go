@@ -0,0 +1,66 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+)
+
+// ModelInfo describes the model being served, for clients that build
+// requests from it and for dashboards.
+type ModelInfo struct {
+    // Name is the name the model is addressed by under /v1/models/.
+    Name        string       `json:"name"`
+    Algorithm   string       `json:"algorithm"`
+    Version     string       `json:"version"`
+    TrainedAt   time.Time    `json:"trained_at"`
+    DatasetHash string       `json:"dataset_hash"`
+    Features    []Feature    `json:"features"`
+    Classes     []string     `json:"classes"`
+    Params      Params       `json:"params"`
+    Training    TrainingInfo `json:"training"`
+    Evaluation  *Evaluation  `json:"evaluation"`
+}
+
+// info returns the metadata of m.
+func (m *Model) info() ModelInfo {
+    schema := m.Schema()
+    params := m.Params
+    if params == nil {
+        params = Params{}
+    }
+    return ModelInfo{
+        Name:        m.Algorithm,
+        Algorithm:   m.Algorithm,
+        Version:     m.Version,
+        TrainedAt:   m.Training.TrainedAt,
+        DatasetHash: m.Training.DatasetHash,
+        Features:    schema.Features,
+        Classes:     schema.Classes,
+        Params:      params,
+        Training:    m.Training,
+        Evaluation:  m.Evaluation,
+    }
+}
+
+// modelHandler describes the model being served. Under /v1/models/{name} the
+// name must be the model's algorithm or version; anything else is 404. The
+// version doubles as an ETag, so clients can cheaply check for a new model.
+func modelHandler(w http.ResponseWriter, r *http.Request) {
+    m := readyModel(w)
+    if m == nil {
+        return
+    }
+    if name := r.PathValue("name"); name != "" && name != m.Algorithm && name != m.Version {
+        writeError(w, http.StatusNotFound, ErrorResponse{Error: "no model named " + name + "; serving " + m.Algorithm + " " + m.Version})
+        return
+    }
+    etag := `"` + m.Version + `"`
+    w.Header().Set("ETag", etag)
+    if r.Header.Get("If-None-Match") == etag {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(m.info())
+}
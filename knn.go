@@ -0,0 +1,288 @@
+package main
+
+import (
+    "container/heap"
+    "encoding/json"
+    "fmt"
+    "math"
+    "math/rand"
+    "sort"
+)
+
+func init() {
+    registerModel("knn", newKNNModel)
+}
+
+// knnModel is a k-nearest-neighbors classifier. Training rows are
+// standardized with the training mean and standard deviation and indexed in a
+// KD-tree, so a lookup visits a small part of the data instead of every row.
+type knnModel struct {
+    Spec  Schema    `json:"schema"`
+    Mean  []float64 `json:"mean"`
+    Scale []float64 `json:"scale"`
+    // Points are the standardized training rows; for the cosine metric they
+    // are also scaled to unit length. Labels holds the class of each point.
+    Points [][]float64 `json:"points"`
+    Labels []int       `json:"labels"`
+
+    k        int
+    metric   string
+    weights  string
+    leafSize int
+    tree     *kdNode
+}
+
+func newKNNModel(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &knnModel{
+        k:        r.int("k", 5),
+        metric:   r.string("metric", "euclidean", "euclidean", "manhattan", "cosine"),
+        weights:  r.string("weights", "uniform", "uniform", "distance"),
+        leafSize: r.int("leaf_size", 16),
+    }
+    r.check("k", m.k > 0, "positive")
+    r.check("leaf_size", m.leafSize > 0, "positive")
+    return m, r.done()
+}
+
+func (m *knnModel) Schema() Schema {
+    return m.Spec
+}
+
+func (m *knnModel) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    m.Spec = ds.schema()
+    m.Mean, m.Scale = columnStats(ds.X)
+    m.Points = make([][]float64, len(ds.X))
+    for i, row := range ds.X {
+        m.Points[i] = m.transform(row)
+    }
+    m.Labels = append([]int(nil), ds.Y...)
+    m.buildTree()
+    return nil
+}
+
+// UnmarshalJSON rebuilds the KD-tree after loading the points from an artifact.
+func (m *knnModel) UnmarshalJSON(data []byte) error {
+    type fields knnModel
+    if err := json.Unmarshal(data, (*fields)(m)); err != nil {
+        return err
+    }
+    if len(m.Points) != len(m.Labels) {
+        return fmt.Errorf("knn: %d points but %d labels", len(m.Points), len(m.Labels))
+    }
+    m.buildTree()
+    return nil
+}
+
+func (m *knnModel) buildTree() {
+    idx := make([]int, len(m.Points))
+    for i := range idx {
+        idx[i] = i
+    }
+    m.tree = buildKDTree(m.Points, idx, m.leafSize)
+}
+
+// transform maps an input row into the space the points are indexed in.
+func (m *knnModel) transform(row []float64) []float64 {
+    out := make([]float64, len(row))
+    var norm float64
+    for j, v := range row {
+        out[j] = (v - m.Mean[j]) / m.Scale[j]
+        norm += out[j] * out[j]
+    }
+    if m.metric == "cosine" && norm > 0 {
+        norm = math.Sqrt(norm)
+        for j := range out {
+            out[j] /= norm
+        }
+    }
+    return out
+}
+
+func (m *knnModel) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+// PredictProba returns the share of the k nearest neighbors' votes each
+// class gets. With distance weighting each vote counts 1/distance, and
+// neighbors at distance zero outvote all others.
+func (m *knnModel) PredictProba(input []float64) ([]float64, error) {
+    if m.tree == nil {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    neighbors := m.nearest(m.transform(input), min(m.k, len(m.Points)))
+    proba := make([]float64, len(m.Spec.Classes))
+    exact := false
+    for _, n := range neighbors {
+        exact = exact || n.dist == 0
+    }
+    for _, n := range neighbors {
+        w := 1.0
+        switch {
+        case exact:
+            if n.dist != 0 {
+                w = 0
+            }
+        case m.weights == "distance":
+            w = 1 / m.distance(n.dist)
+        }
+        proba[m.Labels[n.index]] += w
+    }
+    var sum float64
+    for _, p := range proba {
+        sum += p
+    }
+    for c := range proba {
+        proba[c] /= sum
+    }
+    return proba, nil
+}
+
+// The KD-tree is searched with a reduced distance that orders points the same
+// way as the configured metric but is cheaper to compute: the squared
+// Euclidean distance for euclidean and cosine, and the distance itself for
+// manhattan. On unit vectors the squared Euclidean distance is twice the
+// cosine distance.
+
+// reduced returns the reduced distance between a and b.
+func (m *knnModel) reduced(a, b []float64) float64 {
+    var d float64
+    for j := range a {
+        diff := a[j] - b[j]
+        if m.metric == "manhattan" {
+            d += math.Abs(diff)
+        } else {
+            d += diff * diff
+        }
+    }
+    return d
+}
+
+// reducedAxis returns the reduced distance to a splitting plane diff away,
+// a lower bound on the distance to every point on its other side.
+func (m *knnModel) reducedAxis(diff float64) float64 {
+    if m.metric == "manhattan" {
+        return math.Abs(diff)
+    }
+    return diff * diff
+}
+
+// distance converts a reduced distance to the configured metric.
+func (m *knnModel) distance(reduced float64) float64 {
+    switch m.metric {
+    case "euclidean":
+        return math.Sqrt(reduced)
+    case "cosine":
+        return reduced / 2
+    }
+    return reduced
+}
+
+// kdNode is a node of a KD-tree over the rows of points. A leaf holds the
+// indices of its points; an inner node splits its points at split along axis.
+type kdNode struct {
+    axis        int
+    split       float64
+    left, right *kdNode
+    leaf        []int
+}
+
+// buildKDTree builds a tree over the points indexed by idx, splitting at the
+// median of the axis with the widest spread until at most leafSize points
+// remain. It reorders idx.
+func buildKDTree(points [][]float64, idx []int, leafSize int) *kdNode {
+    if len(idx) <= leafSize {
+        return &kdNode{leaf: idx}
+    }
+    axis, spread := 0, -1.0
+    for j := range points[idx[0]] {
+        lo, hi := math.Inf(1), math.Inf(-1)
+        for _, i := range idx {
+            lo, hi = math.Min(lo, points[i][j]), math.Max(hi, points[i][j])
+        }
+        if hi-lo > spread {
+            axis, spread = j, hi-lo
+        }
+    }
+    if spread == 0 {
+        // Every point is identical; there is nothing to split on.
+        return &kdNode{leaf: idx}
+    }
+    sort.Slice(idx, func(a, b int) bool { return points[idx[a]][axis] < points[idx[b]][axis] })
+    mid := len(idx) / 2
+    node := &kdNode{axis: axis, split: points[idx[mid]][axis]}
+    node.left = buildKDTree(points, idx[:mid], leafSize)
+    node.right = buildKDTree(points, idx[mid:], leafSize)
+    return node
+}
+
+// neighbor is a candidate nearest point and its reduced distance to the query.
+type neighbor struct {
+    index int
+    dist  float64
+}
+
+// neighborHeap is a max-heap of the nearest points found so far, farthest
+// first. Ties go to the lower index so that results are deterministic.
+type neighborHeap []neighbor
+
+func (h neighborHeap) Len() int { return len(h) }
+func (h neighborHeap) Less(i, j int) bool {
+    if h[i].dist != h[j].dist {
+        return h[i].dist > h[j].dist
+    }
+    return h[i].index > h[j].index
+}
+func (h neighborHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *neighborHeap) Push(x any)   { *h = append(*h, x.(neighbor)) }
+func (h *neighborHeap) Pop() any {
+    old := *h
+    n := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return n
+}
+
+// nearest returns the k points closest to q, nearest first.
+func (m *knnModel) nearest(q []float64, k int) []neighbor {
+    h := make(neighborHeap, 0, k+1)
+    m.search(m.tree, q, k, &h)
+    out := make([]neighbor, len(h))
+    for i := len(out) - 1; i >= 0; i-- {
+        out[i] = heap.Pop(&h).(neighbor)
+    }
+    return out
+}
+
+func (m *knnModel) search(node *kdNode, q []float64, k int, h *neighborHeap) {
+    if node.leaf != nil {
+        for _, i := range node.leaf {
+            n := neighbor{index: i, dist: m.reduced(q, m.Points[i])}
+            if h.Len() < k {
+                heap.Push(h, n)
+            } else if top := (*h)[0]; n.dist < top.dist || (n.dist == top.dist && n.index < top.index) {
+                (*h)[0] = n
+                heap.Fix(h, 0)
+            }
+        }
+        return
+    }
+    diff := q[node.axis] - node.split
+    near, far := node.left, node.right
+    if diff >= 0 {
+        near, far = node.right, node.left
+    }
+    m.search(near, q, k, h)
+    if h.Len() < k || m.reducedAxis(diff) <= (*h)[0].dist {
+        m.search(far, q, k, h)
+    }
+}
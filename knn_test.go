@@ -0,0 +1,75 @@
+package main
+
+import (
+    "cmp"
+    "math"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+// TestKNNNearestMatchesBruteForce checks the KD-tree search against a scan
+// of every point, including ties, which both must break by lower index.
+func TestKNNNearestMatchesBruteForce(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    ds := &Dataset{Features: []string{"a", "b", "c"}, Classes: []string{"x", "y"}}
+    for i := 0; i < 500; i++ {
+        row := make([]float64, len(ds.Features))
+        for j := range row {
+            row[j] = rng.NormFloat64() * float64(j+1)
+            if i%5 == 0 {
+                // Coarse values give many equal coordinates and distances.
+                row[j] = math.Round(row[j])
+            }
+        }
+        ds.X = append(ds.X, row)
+        ds.Y = append(ds.Y, i%2)
+    }
+
+    for _, metric := range []string{"euclidean", "manhattan", "cosine"} {
+        t.Run(metric, func(t *testing.T) {
+            p, err := newKNNModel(Params{"metric": metric, "leaf_size": 4})
+            if err != nil {
+                t.Fatal(err)
+            }
+            m := p.(*knnModel)
+            if err := m.Fit(ds, rng); err != nil {
+                t.Fatal(err)
+            }
+            for q := 0; q < 200; q++ {
+                var query []float64
+                if q%4 == 0 {
+                    // Query at a training point, so distance zero is covered.
+                    query = m.Points[rng.Intn(len(m.Points))]
+                } else {
+                    raw := make([]float64, len(ds.Features))
+                    for j := range raw {
+                        raw[j] = rng.NormFloat64() * 2 * float64(j+1)
+                    }
+                    query = m.transform(raw)
+                }
+                for _, k := range []int{1, 5, 17, len(m.Points)} {
+                    got := m.nearest(query, k)
+                    want := bruteForceNearest(m, query, k)
+                    if !slices.Equal(got, want) {
+                        t.Fatalf("query %d, k=%d: nearest = %v, want %v", q, k, got, want)
+                    }
+                }
+            }
+        })
+    }
+}
+
+func bruteForceNearest(m *knnModel, q []float64, k int) []neighbor {
+    all := make([]neighbor, len(m.Points))
+    for i, p := range m.Points {
+        all[i] = neighbor{index: i, dist: m.reduced(q, p)}
+    }
+    slices.SortFunc(all, func(a, b neighbor) int {
+        if c := cmp.Compare(a.dist, b.dist); c != 0 {
+            return c
+        }
+        return cmp.Compare(a.index, b.index)
+    })
+    return all[:k]
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "log/slog"
+    "net/http"
+    "os"
+)
+
+// maxRequestIDLength bounds X-Request-ID values accepted from clients.
+const maxRequestIDLength = 128
+
+// setupLogging makes slog, and the standard log package through it, write
+// JSON lines to stderr at level and above.
+func setupLogging(level slog.Level) {
+    slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// trainLogger is embedded by models that log while they train. Messages go
+// to slog.Default() unless setLogger replaces it, which tune does to keep the
+// training of cross-validation folds out of the log.
+type trainLogger struct {
+    logger *slog.Logger
+}
+
+func (t *trainLogger) setLogger(l *slog.Logger) {
+    t.logger = l
+}
+
+// log returns the logger for training messages.
+func (t *trainLogger) log() *slog.Logger {
+    if t.logger == nil {
+        return slog.Default()
+    }
+    return t.logger
+}
+
+// logEnabled reports whether training messages at level are written, so that
+// values only computed for them can be skipped.
+func (t *trainLogger) logEnabled(level slog.Level) bool {
+    return t.log().Enabled(context.Background(), level)
+}
+
+// discardLogger drops every record.
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+    slog.Error(msg, args...)
+    os.Exit(1)
+}
+
+type ctxKey int
+
+const (
+    loggerKey ctxKey = iota
+    requestIDKey
+)
+
+// loggerFrom returns the request-scoped logger stored in ctx, or the default logger.
+func loggerFrom(ctx context.Context) *slog.Logger {
+    if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+        return l
+    }
+    return slog.Default()
+}
+
+// requestIDFrom returns the request ID stored in ctx, or "".
+func requestIDFrom(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey).(string)
+    return id
+}
+
+// requestID returns the client's X-Request-ID if it is usable, or a new random ID.
+func requestID(r *http.Request) string {
+    if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= maxRequestIDLength && isPrintableASCII(id) {
+        return id
+    }
+    var b [16]byte
+    rand.Read(b[:])
+    return hex.EncodeToString(b[:])
+}
+
+func isPrintableASCII(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] < 0x20 || s[i] > 0x7e {
+            return false
+        }
+    }
+    return true
+}
+
+// withRequestID tags r with a request ID and a logger that includes it, and
+// echoes the ID in the X-Request-ID response header.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+    id := requestID(r)
+    w.Header().Set("X-Request-ID", id)
+    ctx := context.WithValue(r.Context(), requestIDKey, id)
+    ctx = context.WithValue(ctx, loggerKey, slog.Default().With("request_id", id))
+    return r.WithContext(ctx)
+}
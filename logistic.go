@@ -0,0 +1,219 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "math"
+    "math/rand"
+)
+
+func init() {
+    registerModel("logistic", newLogisticModel)
+}
+
+// logisticModel is a multinomial (softmax) logistic regression trained with
+// mini-batch gradient descent and L2 regularization. Inputs are standardized
+// with the training mean and standard deviation before scoring.
+type logisticModel struct {
+    Spec    Schema      `json:"schema"`
+    Mean    []float64   `json:"mean"`
+    Scale   []float64   `json:"scale"`
+    Weights [][]float64 `json:"weights"`
+    Bias    []float64   `json:"bias"`
+
+    learningRate float64
+    epochs       int
+    l2           float64
+    batchSize    int
+    trainLogger
+}
+
+func newLogisticModel(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &logisticModel{
+        learningRate: r.float("learning_rate", 0.1),
+        epochs:       r.int("epochs", 100),
+        l2:           r.float("l2", 1e-4),
+        batchSize:    r.int("batch_size", 32),
+    }
+    r.check("learning_rate", m.learningRate > 0, "positive")
+    r.check("epochs", m.epochs > 0, "positive")
+    r.check("l2", m.l2 >= 0, "non-negative")
+    r.check("batch_size", m.batchSize >= 0, "non-negative (0 means full batch)")
+    return m, r.done()
+}
+
+func (m *logisticModel) Schema() Schema {
+    return m.Spec
+}
+
+func (m *logisticModel) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    n, d, k := len(ds.X), len(ds.Features), len(ds.Classes)
+    m.Spec = ds.schema()
+    m.Mean, m.Scale = columnStats(ds.X)
+    x := make([][]float64, n)
+    for i, row := range ds.X {
+        x[i] = m.standardize(row)
+    }
+
+    m.Weights = make([][]float64, k)
+    for c := range m.Weights {
+        m.Weights[c] = make([]float64, d)
+    }
+    m.Bias = make([]float64, k)
+
+    batchSize := m.batchSize
+    if batchSize == 0 || batchSize > n {
+        batchSize = n
+    }
+    gradW := make([][]float64, k)
+    for c := range gradW {
+        gradW[c] = make([]float64, d)
+    }
+    gradB := make([]float64, k)
+    order := rng.Perm(n)
+
+    for epoch := 1; epoch <= m.epochs; epoch++ {
+        rng.Shuffle(n, func(i, j int) { order[i], order[j] = order[j], order[i] })
+        for start := 0; start < n; start += batchSize {
+            batch := order[start:min(start+batchSize, n)]
+            for c := range gradW {
+                clear(gradW[c])
+            }
+            clear(gradB)
+            for _, i := range batch {
+                p := m.softmax(x[i])
+                p[ds.Y[i]] -= 1
+                for c := range p {
+                    for j, v := range x[i] {
+                        gradW[c][j] += p[c] * v
+                    }
+                    gradB[c] += p[c]
+                }
+            }
+            size := float64(len(batch))
+            for c := range m.Weights {
+                for j := range m.Weights[c] {
+                    m.Weights[c][j] -= m.learningRate * (gradW[c][j]/size + m.l2*m.Weights[c][j])
+                }
+                m.Bias[c] -= m.learningRate * gradB[c] / size
+            }
+        }
+        if m.logEnabled(slog.LevelInfo) {
+            m.log().Info("training epoch", "epoch", epoch, "epochs", m.epochs, "loss", m.loss(x, ds.Y))
+        }
+    }
+    return nil
+}
+
+// loss is the mean cross-entropy of the standardized rows x plus the L2 penalty.
+func (m *logisticModel) loss(x [][]float64, y []int) float64 {
+    var sum float64
+    for i, row := range x {
+        sum -= math.Log(math.Max(m.softmax(row)[y[i]], 1e-15))
+    }
+    var norm float64
+    for _, w := range m.Weights {
+        for _, v := range w {
+            norm += v * v
+        }
+    }
+    return sum/float64(len(x)) + m.l2/2*norm
+}
+
+func (m *logisticModel) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+func (m *logisticModel) PredictProba(input []float64) ([]float64, error) {
+    if m.Weights == nil {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    return m.softmax(m.standardize(input)), nil
+}
+
+// softmax returns the class probabilities for an already standardized row.
+func (m *logisticModel) softmax(x []float64) []float64 {
+    logits := make([]float64, len(m.Weights))
+    for c, w := range m.Weights {
+        logits[c] = m.Bias[c]
+        for j, v := range x {
+            logits[c] += w[j] * v
+        }
+    }
+    return softmax(logits)
+}
+
+func (m *logisticModel) standardize(row []float64) []float64 {
+    out := make([]float64, len(row))
+    for j, v := range row {
+        out[j] = (v - m.Mean[j]) / m.Scale[j]
+    }
+    return out
+}
+
+// columnStats returns the mean and standard deviation of each column of x.
+// Constant columns get a standard deviation of 1 so they can be divided by safely.
+func columnStats(x [][]float64) (mean, std []float64) {
+    d := len(x[0])
+    mean = make([]float64, d)
+    std = make([]float64, d)
+    for _, row := range x {
+        for j, v := range row {
+            mean[j] += v
+        }
+    }
+    for j := range mean {
+        mean[j] /= float64(len(x))
+    }
+    for _, row := range x {
+        for j, v := range row {
+            std[j] += (v - mean[j]) * (v - mean[j])
+        }
+    }
+    for j := range std {
+        std[j] = math.Sqrt(std[j] / float64(len(x)))
+        if std[j] == 0 {
+            std[j] = 1
+        }
+    }
+    return mean, std
+}
+
+// softmax converts logits into probabilities in place and returns them.
+func softmax(logits []float64) []float64 {
+    max := math.Inf(-1)
+    for _, v := range logits {
+        max = math.Max(max, v)
+    }
+    var sum float64
+    for i, v := range logits {
+        logits[i] = math.Exp(v - max)
+        sum += logits[i]
+    }
+    for i := range logits {
+        logits[i] /= sum
+    }
+    return logits
+}
+
+// argmax returns the index of the largest value, preferring the first on ties.
+func argmax(values []float64) int {
+    best := 0
+    for i, v := range values {
+        if v > values[best] {
+            best = i
+        }
+    }
+    return best
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Metrics exposed on /metrics in the Prometheus text format.
+var (
+    requestsTotal = newMetric("model_http_requests_total", "counter",
+        "HTTP requests by handler and status code.", "handler", "code")
+    requestDuration = newHistogram("model_http_request_duration_seconds",
+        "HTTP request latency by handler.", defaultBuckets, "handler")
+    predictionsTotal = newMetric("model_predictions_total", "counter",
+        "Predictions served, by predicted class.", "class")
+    validationFailures = newMetric("model_input_validation_failures_total", "counter",
+        "Input schema violations, by feature. Violations not tied to a schema feature are counted as \"(other)\".", "field")
+    modelInfo = newMetric("model_info", "gauge",
+        "The model being served; always 1.", "algorithm", "version")
+    trainingDuration = newMetric("model_training_duration_seconds", "gauge",
+        "How long the model being served took to train.")
+)
+
+// defaultBuckets are latency histogram bounds in seconds.
+var defaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// registry lists every metric in the order it is exposed.
+var registry []collector
+
+type collector interface {
+    write(w io.Writer)
+}
+
+// metric is a counter or gauge with a fixed set of label names.
+type metric struct {
+    name, kind, help string
+    labels           []string
+
+    mu     sync.Mutex
+    series map[string]*series
+}
+
+type series struct {
+    labelValues []string
+    value       float64
+}
+
+func newMetric(name, kind, help string, labels ...string) *metric {
+    m := &metric{name: name, kind: kind, help: help, labels: labels, series: map[string]*series{}}
+    registry = append(registry, m)
+    return m
+}
+
+// get returns the series for labelValues, creating it at zero. The caller must hold m.mu.
+func (m *metric) get(labelValues []string) *series {
+    key := strings.Join(labelValues, "\xff")
+    s, ok := m.series[key]
+    if !ok {
+        s = &series{labelValues: labelValues}
+        m.series[key] = s
+    }
+    return s
+}
+
+func (m *metric) add(delta float64, labelValues ...string) {
+    m.mu.Lock()
+    m.get(labelValues).value += delta
+    m.mu.Unlock()
+}
+
+func (m *metric) inc(labelValues ...string) {
+    m.add(1, labelValues...)
+}
+
+func (m *metric) set(value float64, labelValues ...string) {
+    m.mu.Lock()
+    m.get(labelValues).value = value
+    m.mu.Unlock()
+}
+
+// reset removes every series, for gauges whose label values change.
+func (m *metric) reset() {
+    m.mu.Lock()
+    m.series = map[string]*series{}
+    m.mu.Unlock()
+}
+
+func (m *metric) write(w io.Writer) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+    for _, s := range sortedSeries(m.series) {
+        fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, s.labelValues), formatValue(s.value))
+    }
+}
+
+// histogram counts observations into cumulative buckets.
+type histogram struct {
+    name, help string
+    labels     []string
+    buckets    []float64
+
+    mu     sync.Mutex
+    series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+    labelValues []string
+    counts      []uint64 // per bucket, not cumulative; the last is +Inf
+    sum         float64
+    count       uint64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogram {
+    h := &histogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+    registry = append(registry, h)
+    return h
+}
+
+func (h *histogram) observe(v float64, labelValues ...string) {
+    key := strings.Join(labelValues, "\xff")
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    s, ok := h.series[key]
+    if !ok {
+        s = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets)+1)}
+        h.series[key] = s
+    }
+    s.counts[sort.SearchFloat64s(h.buckets, v)]++
+    s.sum += v
+    s.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+    keys := make([]string, 0, len(h.series))
+    for key := range h.series {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    labels := append(h.labels[:len(h.labels):len(h.labels)], "le")
+    for _, key := range keys {
+        s := h.series[key]
+        var cumulative uint64
+        for i, count := range s.counts {
+            cumulative += count
+            le := "+Inf"
+            if i < len(h.buckets) {
+                le = formatValue(h.buckets[i])
+            }
+            values := append(s.labelValues[:len(s.labelValues):len(s.labelValues)], le)
+            fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), cumulative)
+        }
+        fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues), formatValue(s.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), s.count)
+    }
+}
+
+func sortedSeries(m map[string]*series) []*series {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    out := make([]*series, len(keys))
+    for i, key := range keys {
+        out[i] = m[key]
+    }
+    return out
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+    if len(names) == 0 {
+        return ""
+    }
+    pairs := make([]string, len(names))
+    for i, name := range names {
+        pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+    }
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricsHandler serves every registered metric in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    for _, c := range registry {
+        c.write(w)
+    }
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+    if r.status == 0 {
+        r.status = status
+    }
+    r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+    if r.status == 0 {
+        r.status = http.StatusOK
+    }
+    return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for flushing.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+    return r.ResponseWriter
+}
+
+// instrument wraps h to assign each request an ID, count requests by status
+// code, record their latency, and log one line per request.
+func instrument(name string, h http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        r = withRequestID(w, r)
+        rec := &statusRecorder{ResponseWriter: w}
+        h(rec, r)
+        if rec.status == 0 {
+            rec.status = http.StatusOK
+        }
+        elapsed := time.Since(start)
+        requestDuration.observe(elapsed.Seconds(), name)
+        requestsTotal.inc(name, strconv.Itoa(rec.status))
+        loggerFrom(r.Context()).Info("request",
+            "handler", name, "method", r.Method, "path", r.URL.Path,
+            "status", rec.status, "duration_ms", float64(elapsed.Microseconds())/1000)
+    }
+}
+
+// recordViolations counts each schema violation under its feature. Unknown
+// names and extra positions share one label so that clients cannot create
+// unbounded numbers of series.
+func recordViolations(violations []Violation) {
+    for _, v := range violations {
+        field := v.Field
+        if field == "" || v.Index < 0 {
+            field = "(other)"
+        }
+        validationFailures.inc(field)
+    }
+}
@@ -2,49 +2,278 @@ package main
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
-    "log"
+    "io"
+    "log/slog"
     "math/rand"
     "net/http"
+    "os"
+    "strconv"
+    "strings"
     "time"
 )
 
 type Prediction struct {
     Input  []float64 `json:"input"`
     Output int       `json:"output"`
+    // Label, Confidence and Probabilities are left out of minimal responses.
+    Label         string             `json:"label,omitempty"`
+    Confidence    float64            `json:"confidence,omitempty"`
+    Probabilities map[string]float64 `json:"probabilities,omitempty"`
 }
 
-func trainModel() {
-    fmt.Println("Model is being trained...")
-    time.Sleep(2 * time.Second) 
-    fmt.Println("Model trained and ready!")
+// predict scores input and returns the full prediction: the class index, its
+// label, and the probability of every class keyed by label.
+func (m *Model) predict(input []float64) (Prediction, error) {
+    output, err := m.Predict(input)
+    if err != nil {
+        return Prediction{}, err
+    }
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return Prediction{}, err
+    }
+    classes := m.Schema().Classes
+    p := Prediction{
+        Input:         input,
+        Output:        output,
+        Label:         classes[output],
+        Confidence:    proba[output],
+        Probabilities: make(map[string]float64, len(classes)),
+    }
+    for i, class := range classes {
+        p.Probabilities[class] = proba[i]
+    }
+    return p, nil
+}
+
+// auditRecord describes a prediction served by m for the audit log. row is
+// the position of the input in a batch, or nil for a single prediction.
+func (m *Model) auditRecord(requestID string, row *int, p Prediction, latency time.Duration) AuditRecord {
+    return AuditRecord{
+        Time:          time.Now().UTC(),
+        RequestID:     requestID,
+        Row:           row,
+        Input:         p.Input,
+        Output:        p.Output,
+        Label:         p.Label,
+        Probabilities: p.Probabilities,
+        Algorithm:     m.Algorithm,
+        ModelVersion:  m.Version,
+        LatencyMS:     float64(latency.Microseconds()) / 1000,
+    }
+}
+
+// minimal strips p down to the original input/output response shape.
+func (p Prediction) minimal() Prediction {
+    return Prediction{Input: p.Input, Output: p.Output}
+}
+
+// trainModel builds the named model and fits it on ds, seeding any randomness
+// in training with seed. If testFraction is positive, that fraction of each
+// class is held out of training and the model is evaluated on it.
+func trainModel(algorithm string, params Params, ds *Dataset, seed int64, testFraction float64) (*Model, error) {
+    p, err := newPredictor(algorithm, params)
+    if err != nil {
+        return nil, err
+    }
+    train, test := ds, (*Dataset)(nil)
+    if testFraction > 0 {
+        train, test = ds.split(testFraction, seed)
+    }
+    slog.Info("training model", "algorithm", algorithm, "rows", len(train.X), "features", len(ds.Features), "seed", seed)
+    start := time.Now()
+    if t, ok := p.(Trainer); ok {
+        if err := t.Fit(train, rand.New(rand.NewSource(seed))); err != nil {
+            return nil, err
+        }
+    }
+    elapsed := time.Since(start)
+    slog.Info("model trained", "algorithm", algorithm, "duration_ms", elapsed.Milliseconds())
+    info := TrainingInfo{
+        TrainedAt:   start.UTC(),
+        Duration:    elapsed.Seconds(),
+        Rows:        len(train.X),
+        DatasetHash: ds.hash(),
+        Seed:        seed,
+    }
+    if test != nil {
+        info.TestRows = len(test.X)
+    }
+    m, err := newModel(p, algorithm, params, info)
+    if err != nil {
+        return nil, err
+    }
+    if test != nil && len(test.X) > 0 {
+        if m.Evaluation, err = m.evaluate(test); err != nil {
+            return nil, fmt.Errorf("evaluating model: %w", err)
+        }
+        logEvaluation(m)
+    }
+    return m, nil
 }
 
-func predict(inputData []float64) int {
-    rand.Seed(time.Now().UnixNano())
-    return rand.Intn(3) 
+// logEvaluation logs a summary of m's evaluation, if it has one.
+func logEvaluation(m *Model) {
+    e := m.Evaluation
+    if e == nil {
+        return
+    }
+    slog.Info("model evaluation", "algorithm", m.Algorithm, "version", m.Version, "test_rows", e.Rows,
+        "accuracy", e.Accuracy, "macro_f1", e.MacroAvg.F1, "weighted_f1", e.WeightedAvg.F1,
+        "labels", e.Labels, "confusion", e.Confusion)
+}
+
+// maxPredictBody is the largest request body /predict accepts, in bytes.
+const maxPredictBody = 1 << 20
+
+// bodyTooLarge reports whether err came from reading past an
+// http.MaxBytesReader limit, and if so responds with 413.
+func bodyTooLarge(w http.ResponseWriter, err error) bool {
+    var tooLarge *http.MaxBytesError
+    if !errors.As(err, &tooLarge) {
+        return false
+    }
+    http.Error(w, fmt.Sprintf("Request body too large: the limit is %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+    return true
 }
 
+// predictHandler scores one input, given either as an array of feature
+// values or as an object keyed by feature name. Clients that only understand the
+// original {input, output} response can ask for it with ?minimal=true.
+// Input that does not match the model's schema is rejected with 422 and a
+// list of every violation.
 func predictHandler(w http.ResponseWriter, r *http.Request) {
-    var input []float64
-    err := json.NewDecoder(r.Body).Decode(&input)
+    start := time.Now()
+    model := readyModel(w)
+    if model == nil {
+        return
+    }
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPredictBody))
+    if bodyTooLarge(w, err) {
+        return
+    }
+    if err != nil {
+        http.Error(w, "Invalid input", http.StatusBadRequest)
+        return
+    }
+    input, err := decodeInput(body, model.Schema())
+    var verr *ValidationError
+    if errors.As(err, &verr) {
+        recordViolations(verr.Violations)
+        loggerFrom(r.Context()).Info("input rejected", "violations", len(verr.Violations), "error", verr.Error())
+        writeError(w, http.StatusUnprocessableEntity, ErrorResponse{Error: "input does not match the model schema", Violations: verr.Violations})
+        return
+    }
     if err != nil {
         http.Error(w, "Invalid input", http.StatusBadRequest)
         return
     }
 
-    output := predict(input)
-    response := Prediction{Input: input, Output: output}
+    response, err := model.predict(input)
+    if err != nil {
+        http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+    predictionsTotal.inc(response.Label)
+    audit.record(model.auditRecord(requestIDFrom(r.Context()), nil, response, time.Since(start)))
+    loggerFrom(r.Context()).Debug("prediction", "output", response.Output, "label", response.Label, "confidence", response.Confidence)
+    if minimal, _ := strconv.ParseBool(r.URL.Query().Get("minimal")); minimal {
+        response = response.minimal()
+    }
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(response)
 }
 
 func main() {
-    trainModel()
+    name, args := "serve", os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        name, args = args[0], args[1:]
+    }
+    cmd, ok := findCommand(name)
+    if !ok {
+        usage()
+        os.Exit(2)
+    }
+    if err := cmd.run(args); err != nil {
+        fatal(name+" failed", "error", err)
+    }
+}
+
+// trainFromConfig loads the training data named in cfg and trains the configured model on it.
+func trainFromConfig(cfg *Config) (*Model, error) {
+    ds, err := loadTrainingData(cfg.DataPath, csvOptions{Label: cfg.Label, Features: cfg.Features})
+    if err != nil {
+        return nil, err
+    }
+    ds.RangeMargin = cfg.RangeMargin
+    ds.FillMissing = cfg.FillMissing
+    return trainModel(cfg.Algorithm, cfg.Params, ds, cfg.Seed, cfg.TestFraction)
+}
 
+// runServe implements the serve command: it starts the HTTP server, then
+// loads or trains the model to serve.
+func runServe(args []string) error {
+    cfg, err := commandConfig("serve", "[serve] [flags]",
+        "Loads the -model artifact, or trains a model, and serves predictions over HTTP.", args, true)
+    if err != nil {
+        return err
+    }
+    if cfg.AuditPath != "" {
+        if audit, err = openAuditLog(cfg.AuditPath, int64(cfg.AuditMaxBytes), cfg.AuditBackups, cfg.AuditSampleRate); err != nil {
+            return fmt.Errorf("opening audit log: %w", err)
+        }
+        onShutdown(audit.close)
+    }
 
-    http.HandleFunc("/predict", predictHandler)
-    fmt.Println("Server is running on port 8080")
-    log.Fatal(http.ListenAndServe(":8080", nil))
+    // startModel loads or trains the model to serve. It runs after the
+    // listener is up so that /healthz answers while training is in progress.
+    startModel := func() (*Model, error) {
+        if cfg.ModelPath != "" && !cfg.Train {
+            m, err := loadModel(cfg.ModelPath)
+            if err != nil {
+                return nil, err
+            }
+            slog.Info("model loaded", "algorithm", m.Algorithm, "version", m.Version, "path", cfg.ModelPath)
+            logEvaluation(m)
+            return m, nil
+        }
+        m, err := trainFromConfig(cfg)
+        if err != nil {
+            return nil, err
+        }
+        if cfg.ModelPath != "" {
+            if err := saveModel(m, cfg.ModelPath); err != nil {
+                return nil, err
+            }
+            slog.Info("model saved", "algorithm", m.Algorithm, "version", m.Version, "path", cfg.ModelPath)
+        }
+        return m, nil
+    }
+    go func() {
+        m, err := startModel()
+        if err != nil {
+            fatal("no model to serve", "error", err)
+        }
+        serveModel(m)
+        slog.Info("serving model", "algorithm", m.Algorithm, "version", m.Version)
+    }()
+
+    http.HandleFunc("/predict", instrument("predict", predictHandler))
+    http.HandleFunc("/predict/batch", instrument("batch", batchHandler))
+    http.HandleFunc("GET /model", instrument("model", modelHandler))
+    http.HandleFunc("GET /model/info", instrument("model", modelHandler))
+    http.HandleFunc("GET /v1/models/{name}", instrument("model", modelHandler))
+    http.HandleFunc("/healthz", instrument("healthz", healthzHandler))
+    http.HandleFunc("/readyz", instrument("readyz", readyzHandler))
+    http.HandleFunc("/metrics", metricsHandler)
+    srv := &http.Server{
+        Addr:         cfg.Addr,
+        ReadTimeout:  time.Duration(cfg.ReadTimeout),
+        WriteTimeout: time.Duration(cfg.WriteTimeout),
+    }
+    slog.Info("server is running", "addr", cfg.Addr)
+    return serve(srv, time.Duration(cfg.ShutdownTimeout))
 }
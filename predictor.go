@@ -0,0 +1,229 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Predictor is a classification model that can be served behind /predict.
+type Predictor interface {
+    // Predict returns the index of the most likely class for input.
+    Predict(input []float64) (int, error)
+    // PredictProba returns one probability per class, in the order of Schema().Classes.
+    PredictProba(input []float64) ([]float64, error)
+    // Schema describes the input the predictor accepts and the classes it emits.
+    Schema() Schema
+}
+
+// Trainer is implemented by predictors that learn their parameters from data.
+type Trainer interface {
+    // Fit trains the predictor on ds. Any randomness must come from rng.
+    Fit(ds *Dataset, rng *rand.Rand) error
+}
+
+// Feature types.
+const (
+    featureNumber  = "number"
+    featureInteger = "integer"
+)
+
+// Feature describes one position of the input vector and the values it accepts.
+// Min and Max are inclusive; nil means unbounded. Default, if set, is used
+// when a named-feature input leaves the feature out.
+type Feature struct {
+    Name    string   `json:"name"`
+    Type    string   `json:"type,omitempty"`
+    Min     *float64 `json:"min,omitempty"`
+    Max     *float64 `json:"max,omitempty"`
+    Default *float64 `json:"default,omitempty"`
+}
+
+// Schema describes a predictor's input vector and output classes.
+// A schema without features accepts input of any length.
+type Schema struct {
+    Features []Feature `json:"features"`
+    Classes  []string  `json:"classes"`
+}
+
+// check reports whether input has the shape the schema expects.
+func (s Schema) check(input []float64) error {
+    if len(input) == 0 {
+        return fmt.Errorf("input is empty")
+    }
+    if len(s.Features) > 0 && len(input) != len(s.Features) {
+        return fmt.Errorf("expected %d features, got %d", len(s.Features), len(input))
+    }
+    return nil
+}
+
+// Params holds a model's hyperparameters by name. Values are numbers or
+// strings, as decoded from JSON or given on the command line.
+type Params map[string]any
+
+// reader returns a paramReader over p.
+func (p Params) reader() *paramReader {
+    return &paramReader{params: p, used: map[string]bool{}}
+}
+
+// paramReader reads typed hyperparameters out of Params and remembers the
+// first error, so a model constructor can read all of its parameters and
+// check for failure once at the end.
+type paramReader struct {
+    params Params
+    used   map[string]bool
+    err    error
+}
+
+func (r *paramReader) float(name string, def float64) float64 {
+    r.used[name] = true
+    v, ok := r.params[name]
+    if !ok {
+        return def
+    }
+    switch v := v.(type) {
+    case float64:
+        return v
+    case int:
+        return float64(v)
+    case string:
+        f, err := strconv.ParseFloat(v, 64)
+        if err == nil {
+            return f
+        }
+    }
+    r.fail(fmt.Errorf("parameter %s: %v is not a number", name, v))
+    return def
+}
+
+func (r *paramReader) int(name string, def int) int {
+    f := r.float(name, float64(def))
+    if f != math.Trunc(f) {
+        r.fail(fmt.Errorf("parameter %s: %v is not an integer", name, f))
+        return def
+    }
+    return int(f)
+}
+
+// string reads a parameter that names one of choices.
+func (r *paramReader) string(name, def string, choices ...string) string {
+    r.used[name] = true
+    v, ok := r.params[name]
+    if !ok {
+        return def
+    }
+    s, ok := v.(string)
+    if ok && slices.Contains(choices, s) {
+        return s
+    }
+    r.fail(fmt.Errorf("parameter %s: %v is not one of %s", name, v, strings.Join(choices, ", ")))
+    return def
+}
+
+// check records an error for name unless ok holds.
+func (r *paramReader) check(name string, ok bool, want string) {
+    if !ok {
+        r.fail(fmt.Errorf("parameter %s must be %s", name, want))
+    }
+}
+
+func (r *paramReader) fail(err error) {
+    if r.err == nil {
+        r.err = err
+    }
+}
+
+// done returns the first error seen, or an error naming a parameter that was never read.
+func (r *paramReader) done() error {
+    if r.err != nil {
+        return r.err
+    }
+    for name := range r.params {
+        if !r.used[name] {
+            return fmt.Errorf("unknown parameter %q", name)
+        }
+    }
+    return nil
+}
+
+// models maps a model name to a constructor for an untrained instance.
+var models = map[string]func(Params) (Predictor, error){}
+
+// registerModel makes a model selectable by name. It is meant to be called from init.
+func registerModel(name string, factory func(Params) (Predictor, error)) {
+    if _, dup := models[name]; dup {
+        panic("model registered twice: " + name)
+    }
+    models[name] = factory
+}
+
+// newPredictor returns an untrained instance of the named model configured with params.
+func newPredictor(name string, params Params) (Predictor, error) {
+    factory, ok := models[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown model %q (available: %s)", name, strings.Join(modelNames(), ", "))
+    }
+    p, err := factory(params)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", name, err)
+    }
+    return p, nil
+}
+
+// modelNames returns the registered model names in sorted order.
+func modelNames() []string {
+    names := make([]string, 0, len(models))
+    for name := range models {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func init() {
+    registerModel("random", func(params Params) (Predictor, error) {
+        m := &randomModel{Classes: []string{"0", "1", "2"}}
+        return m, params.reader().done()
+    })
+}
+
+// randomModel ignores its input and picks a class uniformly at random.
+// It is kept as a baseline to compare real models against.
+type randomModel struct {
+    Classes []string
+}
+
+func (m *randomModel) Predict(input []float64) (int, error) {
+    if err := m.Schema().check(input); err != nil {
+        return 0, err
+    }
+    return rand.Intn(len(m.Classes)), nil
+}
+
+func (m *randomModel) PredictProba(input []float64) ([]float64, error) {
+    if err := m.Schema().check(input); err != nil {
+        return nil, err
+    }
+    proba := make([]float64, len(m.Classes))
+    for i := range proba {
+        proba[i] = 1 / float64(len(proba))
+    }
+    return proba, nil
+}
+
+// Fit only records the classes of ds; the model has nothing to learn.
+func (m *randomModel) Fit(ds *Dataset, rng *rand.Rand) error {
+    if len(ds.Classes) == 0 {
+        return fmt.Errorf("dataset has no classes")
+    }
+    m.Classes = ds.Classes
+    return nil
+}
+
+func (m *randomModel) Schema() Schema {
+    return Schema{Classes: m.Classes}
+}
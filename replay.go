@@ -0,0 +1,196 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+)
+
+// ReplayReport compares the predictions recorded in audit logs with the
+// predictions of another model on the same inputs.
+type ReplayReport struct {
+    Algorithm    string   `json:"algorithm"`
+    ModelVersion string   `json:"model_version"`
+    Files        []string `json:"files"`
+    Records      int      `json:"records"`
+    Scored       int      `json:"scored"`
+    Agreed       int      `json:"agreed"`
+    Agreement    float64  `json:"agreement"`
+    Unscorable   int      `json:"unscorable"`
+    Malformed    int      `json:"malformed"`
+    // Labels lists every label seen, logged or replayed, in sorted order.
+    Labels []string `json:"labels"`
+    // Flips counts records by logged label, then replayed label.
+    Flips   map[string]map[string]int `json:"flips"`
+    Changed []ReplayChange            `json:"changed"`
+}
+
+// ReplayChange is a record whose replayed prediction differs from the logged one.
+type ReplayChange struct {
+    File       string    `json:"file"`
+    Line       int       `json:"line"`
+    RequestID  string    `json:"request_id"`
+    Row        *int      `json:"row,omitempty"`
+    Input      []float64 `json:"input"`
+    Logged     string    `json:"logged"`
+    Replayed   string    `json:"replayed,omitempty"`
+    Confidence float64   `json:"confidence,omitempty"`
+    Error      string    `json:"error,omitempty"`
+}
+
+// runReplay implements the replay subcommand.
+func runReplay(args []string) error {
+    fs := flag.NewFlagSet("replay", flag.ExitOnError)
+    modelPath := fs.String("model", "", "model artifact to replay the captured inputs against (required)")
+    maxChanged := fs.Int("changes", 20, "maximum number of changed rows to list; -1 lists all")
+    asJSON := fs.Bool("json", false, "print the report as JSON")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s replay -model artifact [flags] [audit log ...]\n\n", os.Args[0])
+        fmt.Fprintf(fs.Output(), "Re-scores the inputs in captured audit logs (default requests.jsonl) and reports how the\nmodel's answers differ from the logged ones.\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if *modelPath == "" {
+        fs.Usage()
+        return fmt.Errorf("replay: -model is required")
+    }
+    files := fs.Args()
+    if len(files) == 0 {
+        files = []string{"requests.jsonl"}
+    }
+
+    m, err := loadModel(*modelPath)
+    if err != nil {
+        return err
+    }
+    report := &ReplayReport{
+        Algorithm:    m.Algorithm,
+        ModelVersion: m.Version,
+        Files:        files,
+        Flips:        map[string]map[string]int{},
+        Changed:      []ReplayChange{},
+    }
+    for _, path := range files {
+        if err := report.replayFile(m, path, *maxChanged); err != nil {
+            return err
+        }
+    }
+    report.finish()
+
+    if *asJSON {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        return enc.Encode(report)
+    }
+    report.print(os.Stdout)
+    return nil
+}
+
+// replayFile scores every record in the audit log at path.
+func (rep *ReplayReport) replayFile(m *Model, path string, maxChanged int) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+    for line := 1; scanner.Scan(); line++ {
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+        var rec AuditRecord
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Input == nil {
+            rep.Malformed++
+            continue
+        }
+        rep.Records++
+        change := ReplayChange{File: path, Line: line, RequestID: rec.RequestID, Row: rec.Row, Input: rec.Input, Logged: rec.Label}
+        p, err := m.predict(rec.Input)
+        if err != nil {
+            rep.Unscorable++
+            change.Error = err.Error()
+        } else {
+            rep.Scored++
+            if rep.Flips[rec.Label] == nil {
+                rep.Flips[rec.Label] = map[string]int{}
+            }
+            rep.Flips[rec.Label][p.Label]++
+            if p.Label == rec.Label {
+                rep.Agreed++
+                continue
+            }
+            change.Replayed, change.Confidence = p.Label, p.Confidence
+        }
+        if maxChanged < 0 || len(rep.Changed) < maxChanged {
+            rep.Changed = append(rep.Changed, change)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    return nil
+}
+
+// finish computes the summary fields once every file has been replayed.
+func (rep *ReplayReport) finish() {
+    if rep.Scored > 0 {
+        rep.Agreement = float64(rep.Agreed) / float64(rep.Scored)
+    }
+    seen := map[string]bool{}
+    for logged, row := range rep.Flips {
+        seen[logged] = true
+        for replayed := range row {
+            seen[replayed] = true
+        }
+    }
+    for label := range seen {
+        rep.Labels = append(rep.Labels, label)
+    }
+    sort.Strings(rep.Labels)
+}
+
+func (rep *ReplayReport) print(out io.Writer) {
+    fmt.Fprintf(out, "Replayed %d records from %s against %s model %s\n",
+        rep.Records, strings.Join(rep.Files, ", "), rep.Algorithm, rep.ModelVersion)
+    fmt.Fprintf(out, "Agreement: %.2f%% (%d of %d scored)\n", 100*rep.Agreement, rep.Agreed, rep.Scored)
+    if rep.Unscorable > 0 || rep.Malformed > 0 {
+        fmt.Fprintf(out, "Could not score %d records; skipped %d malformed lines\n", rep.Unscorable, rep.Malformed)
+    }
+
+    if len(rep.Labels) > 0 {
+        fmt.Fprintf(out, "\nFlips (rows: logged label, columns: replayed label)\n")
+        tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+        fmt.Fprintf(tw, "\t%s\t\n", strings.Join(rep.Labels, "\t"))
+        for _, logged := range rep.Labels {
+            cells := []string{logged}
+            for _, replayed := range rep.Labels {
+                cells = append(cells, strconv.Itoa(rep.Flips[logged][replayed]))
+            }
+            fmt.Fprintf(tw, "%s\t\n", strings.Join(cells, "\t"))
+        }
+        tw.Flush()
+    }
+
+    if len(rep.Changed) > 0 {
+        fmt.Fprintf(out, "\nChanged rows (first %d of %d)\n", len(rep.Changed), rep.Scored-rep.Agreed+rep.Unscorable)
+        tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, "FILE:LINE\tREQUEST ID\tLOGGED\tREPLAYED\tCONFIDENCE\tINPUT")
+        for _, c := range rep.Changed {
+            replayed, confidence := c.Replayed, fmt.Sprintf("%.3f", c.Confidence)
+            if c.Error != "" {
+                replayed, confidence = "error: "+c.Error, "-"
+            }
+            input, _ := json.Marshal(c.Input)
+            fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\t%s\t%s\n", c.File, c.Line, c.RequestID, c.Logged, replayed, confidence, input)
+        }
+        tw.Flush()
+    }
+}
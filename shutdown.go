@@ -0,0 +1,63 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "net/http"
+    "os"
+    "os/signal"
+    "sync/atomic"
+    "syscall"
+    "time"
+)
+
+// draining is set once shutdown has begun, so /readyz can take the instance
+// out of rotation while in-flight requests finish.
+var draining atomic.Bool
+
+// shutdownHooks run in registration order after the server has drained, to
+// flush anything still buffered before the process exits.
+var shutdownHooks []func()
+
+// onShutdown registers f to run during graceful shutdown. It must be called before serve.
+func onShutdown(f func()) {
+    shutdownHooks = append(shutdownHooks, f)
+}
+
+// serve runs srv until it fails or the process receives SIGINT or SIGTERM.
+// On a signal it stops accepting connections, waits up to drainTimeout for
+// in-flight requests to finish, closes whatever is left, and runs the
+// shutdown hooks. A second signal during the drain kills the process.
+func serve(srv *http.Server, drainTimeout time.Duration) error {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    errc := make(chan error, 1)
+    go func() {
+        errc <- srv.ListenAndServe()
+    }()
+    select {
+    case err := <-errc:
+        return err
+    case <-ctx.Done():
+    }
+    stop()
+
+    draining.Store(true)
+    slog.Info("shutting down, draining in-flight requests", "timeout", drainTimeout.String())
+    drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+    defer cancel()
+    if err := srv.Shutdown(drainCtx); err != nil {
+        slog.Warn("drain incomplete, closing remaining connections", "error", err)
+        srv.Close()
+    }
+    if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+        slog.Error("server failed", "error", err)
+    }
+    for _, f := range shutdownHooks {
+        f()
+    }
+    slog.Info("server stopped")
+    return nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+    "cmp"
+    "fmt"
+    "io"
+    "math"
+    "math/rand"
+    "slices"
+    "strconv"
+    "strings"
+)
+
+func init() {
+    registerModel("tree", newTreeModel)
+}
+
+// treeModel is a CART decision tree classifier.
+type treeModel struct {
+    Spec Schema    `json:"schema"`
+    Root *treeNode `json:"root"`
+
+    cart cart
+}
+
+func newTreeModel(params Params) (Predictor, error) {
+    r := params.reader()
+    m := &treeModel{cart: readCART(r)}
+    return m, r.done()
+}
+
+func (m *treeModel) Schema() Schema {
+    return m.Spec
+}
+
+func (m *treeModel) Fit(ds *Dataset, rng *rand.Rand) error {
+    if err := ds.validate(); err != nil {
+        return err
+    }
+    m.Spec = ds.schema()
+    rows := make([]int, len(ds.X))
+    for i := range rows {
+        rows[i] = i
+    }
+    m.Root = m.cart.grow(ds, rows, rng)
+    return nil
+}
+
+func (m *treeModel) Predict(input []float64) (int, error) {
+    proba, err := m.PredictProba(input)
+    if err != nil {
+        return 0, err
+    }
+    return argmax(proba), nil
+}
+
+// PredictProba returns the class distribution of the training rows in the
+// leaf input falls into.
+func (m *treeModel) PredictProba(input []float64) ([]float64, error) {
+    if m.Root == nil {
+        return nil, fmt.Errorf("model is not trained")
+    }
+    if err := m.Spec.check(input); err != nil {
+        return nil, err
+    }
+    return m.Root.leaf(input).proba(), nil
+}
+
+// treeNode is a node of a decision tree. Inner nodes send inputs whose
+// Feature is at most Threshold to Left and the rest to Right; leaves have no
+// children. Counts is the number of training rows of each class that reached
+// the node.
+type treeNode struct {
+    Feature   int       `json:"feature"`
+    Threshold float64   `json:"threshold"`
+    Left      *treeNode `json:"left,omitempty"`
+    Right     *treeNode `json:"right,omitempty"`
+    Counts    []int     `json:"counts"`
+}
+
+func (n *treeNode) isLeaf() bool {
+    return n.Left == nil
+}
+
+// leaf returns the leaf input falls into.
+func (n *treeNode) leaf(input []float64) *treeNode {
+    for !n.isLeaf() {
+        if input[n.Feature] <= n.Threshold {
+            n = n.Left
+        } else {
+            n = n.Right
+        }
+    }
+    return n
+}
+
+func (n *treeNode) samples() int {
+    total := 0
+    for _, c := range n.Counts {
+        total += c
+    }
+    return total
+}
+
+// proba returns the class distribution of the node's training rows.
+func (n *treeNode) proba() []float64 {
+    p := make([]float64, len(n.Counts))
+    total := float64(n.samples())
+    for c, count := range n.Counts {
+        p[c] = float64(count) / total
+    }
+    return p
+}
+
+// cart holds the hyperparameters of the CART tree learner.
+type cart struct {
+    criterion       string
+    maxDepth        int
+    minSamplesSplit int
+    minSamplesLeaf  int
+    ccpAlpha        float64
+    // maxFeatures is how many randomly chosen features each split considers,
+    // or 0 for all of them in order.
+    maxFeatures int
+}
+
+// readCART reads the tree hyperparameters shared by every tree-based model.
+func readCART(r *paramReader) cart {
+    c := cart{
+        criterion:       r.string("criterion", "gini", "gini", "entropy"),
+        maxDepth:        r.int("max_depth", 0),
+        minSamplesSplit: r.int("min_samples_split", 2),
+        minSamplesLeaf:  r.int("min_samples_leaf", 1),
+        ccpAlpha:        r.float("ccp_alpha", 0),
+    }
+    r.check("max_depth", c.maxDepth >= 0, "non-negative (0 means unlimited)")
+    r.check("min_samples_split", c.minSamplesSplit >= 2, "at least 2")
+    r.check("min_samples_leaf", c.minSamplesLeaf >= 1, "at least 1")
+    r.check("ccp_alpha", c.ccpAlpha >= 0, "non-negative")
+    return c
+}
+
+// impurity returns the Gini impurity or entropy of a class distribution.
+func (c cart) impurity(counts []int, n int) float64 {
+    if n == 0 {
+        return 0
+    }
+    var sum float64
+    for _, count := range counts {
+        if count == 0 {
+            continue
+        }
+        p := float64(count) / float64(n)
+        if c.criterion == "entropy" {
+            sum -= p * math.Log2(p)
+        } else {
+            sum += p * p
+        }
+    }
+    if c.criterion == "entropy" {
+        return sum
+    }
+    return 1 - sum
+}
+
+// grow builds a tree on the given rows of ds, which may repeat, and prunes it.
+func (c cart) grow(ds *Dataset, rows []int, rng *rand.Rand) *treeNode {
+    root := c.split(ds, rows, 0, rng)
+    if c.ccpAlpha > 0 {
+        c.prune(root, len(rows))
+    }
+    return root
+}
+
+// split grows the subtree for rows at depth, splitting greedily on the
+// threshold that most reduces the weighted impurity of the children.
+func (c cart) split(ds *Dataset, rows []int, depth int, rng *rand.Rand) *treeNode {
+    node := &treeNode{Feature: -1, Counts: make([]int, len(ds.Classes))}
+    for _, i := range rows {
+        node.Counts[ds.Y[i]]++
+    }
+    n := len(rows)
+    parent := c.impurity(node.Counts, n)
+    if parent == 0 || n < c.minSamplesSplit || n < 2*c.minSamplesLeaf || (c.maxDepth > 0 && depth >= c.maxDepth) {
+        return node
+    }
+
+    features := make([]int, len(ds.Features))
+    for j := range features {
+        features[j] = j
+    }
+    if c.maxFeatures > 0 {
+        rng.Shuffle(len(features), func(i, j int) { features[i], features[j] = features[j], features[i] })
+    }
+    best, bestFeature, bestThreshold := float64(n)*parent, -1, 0.0
+    left, right := make([]int, len(ds.Classes)), make([]int, len(ds.Classes))
+    sorted := make([]labeledValue, n)
+    for tried, j := range features {
+        // Like other CART implementations, keep looking past maxFeatures
+        // until some valid split has been found.
+        if c.maxFeatures > 0 && tried >= c.maxFeatures && bestFeature >= 0 {
+            break
+        }
+        for k, i := range rows {
+            sorted[k] = labeledValue{ds.X[i][j], ds.Y[i]}
+        }
+        slices.SortFunc(sorted, func(a, b labeledValue) int { return cmp.Compare(a.value, b.value) })
+        clear(left)
+        copy(right, node.Counts)
+        for k := 0; k < n-1; k++ {
+            y := sorted[k].label
+            left[y]++
+            right[y]--
+            v, next := sorted[k].value, sorted[k+1].value
+            nl, nr := k+1, n-k-1
+            if v == next || nl < c.minSamplesLeaf || nr < c.minSamplesLeaf {
+                continue
+            }
+            score := float64(nl)*c.impurity(left, nl) + float64(nr)*c.impurity(right, nr)
+            if score < best-1e-12 {
+                best, bestFeature, bestThreshold = score, j, midpoint(v, next)
+            }
+        }
+    }
+    if bestFeature < 0 {
+        return node
+    }
+
+    var leftRows, rightRows []int
+    for _, i := range rows {
+        if ds.X[i][bestFeature] <= bestThreshold {
+            leftRows = append(leftRows, i)
+        } else {
+            rightRows = append(rightRows, i)
+        }
+    }
+    node.Feature, node.Threshold = bestFeature, bestThreshold
+    node.Left = c.split(ds, leftRows, depth+1, rng)
+    node.Right = c.split(ds, rightRows, depth+1, rng)
+    return node
+}
+
+// labeledValue is one row's value of the feature being split on, and its class.
+type labeledValue struct {
+    value float64
+    label int
+}
+
+// midpoint returns a threshold between a < b that sends a left and b right.
+func midpoint(a, b float64) float64 {
+    mid := a + (b-a)/2
+    if mid >= b {
+        return a
+    }
+    return mid
+}
+
+// prune applies minimal cost-complexity pruning: it repeatedly collapses the
+// inner node whose subtree buys the least impurity reduction per extra leaf,
+// as long as that is no more than ccpAlpha. total is the number of training
+// rows, which weights node impurities.
+func (c cart) prune(root *treeNode, total int) {
+    for {
+        var weakest *treeNode
+        weakestAlpha := math.Inf(1)
+        var walk func(n *treeNode) (risk float64, leaves int)
+        walk = func(n *treeNode) (float64, int) {
+            own := c.impurity(n.Counts, n.samples()) * float64(n.samples()) / float64(total)
+            if n.isLeaf() {
+                return own, 1
+            }
+            lr, ll := walk(n.Left)
+            rr, rl := walk(n.Right)
+            risk, leaves := lr+rr, ll+rl
+            if alpha := (own - risk) / float64(leaves-1); alpha < weakestAlpha {
+                weakest, weakestAlpha = n, alpha
+            }
+            return risk, leaves
+        }
+        walk(root)
+        if weakest == nil || weakestAlpha > c.ccpAlpha {
+            return
+        }
+        weakest.Feature, weakest.Threshold, weakest.Left, weakest.Right = -1, 0, nil, nil
+    }
+}
+
+// treeExporter is implemented by tree models, which the export command can
+// write out as readable rules or as a Graphviz graph.
+type treeExporter interface {
+    writeRules(w io.Writer)
+    writeDOT(w io.Writer)
+}
+
+// writeRules writes the tree as nested if/else rules, one line per branch.
+func (m *treeModel) writeRules(w io.Writer) {
+    writeTreeRules(w, m.Root, m.Spec)
+}
+
+// writeDOT writes the tree as a Graphviz digraph.
+func (m *treeModel) writeDOT(w io.Writer) {
+    writeTreeDOT(w, m.Root, m.Spec, m.cart.criterion)
+}
+
+// formatThreshold formats a split threshold with as many digits as it takes
+// to read back the same float64, so exported rules route every input exactly
+// as the model does.
+func formatThreshold(t float64) string {
+    return strconv.FormatFloat(t, 'g', -1, 64)
+}
+
+func writeTreeRules(w io.Writer, root *treeNode, spec Schema) {
+    var walk func(n *treeNode, depth int)
+    walk = func(n *treeNode, depth int) {
+        indent := strings.Repeat("|   ", depth) + "|--- "
+        if n.isLeaf() {
+            p := n.proba()
+            c := argmax(p)
+            fmt.Fprintf(w, "%sclass: %s (%d rows, %.1f%%)\n", indent, spec.Classes[c], n.samples(), 100*p[c])
+            return
+        }
+        name, threshold := spec.Features[n.Feature].Name, formatThreshold(n.Threshold)
+        fmt.Fprintf(w, "%s%s <= %s\n", indent, name, threshold)
+        walk(n.Left, depth+1)
+        fmt.Fprintf(w, "%s%s >  %s\n", indent, name, threshold)
+        walk(n.Right, depth+1)
+    }
+    walk(root, 0)
+}
+
+func writeTreeDOT(w io.Writer, root *treeNode, spec Schema, criterion string) {
+    c := cart{criterion: criterion}
+    fmt.Fprintln(w, "digraph tree {")
+    fmt.Fprintln(w, `    node [shape=box, style="rounded", fontname="helvetica"];`)
+    fmt.Fprintln(w, `    edge [fontname="helvetica"];`)
+    id := 0
+    var walk func(n *treeNode) int
+    walk = func(n *treeNode) int {
+        self := id
+        id++
+        var label []string
+        if !n.isLeaf() {
+            label = append(label, fmt.Sprintf("%s <= %s", spec.Features[n.Feature].Name, formatThreshold(n.Threshold)))
+        }
+        label = append(label,
+            fmt.Sprintf("%s = %.3f", criterion, c.impurity(n.Counts, n.samples())),
+            fmt.Sprintf("samples = %d", n.samples()),
+            fmt.Sprintf("value = %v", n.Counts),
+            "class = "+spec.Classes[argmax(n.proba())])
+        fmt.Fprintf(w, "    %d [label=%q];\n", self, strings.Join(label, "\n"))
+        if !n.isLeaf() {
+            l := walk(n.Left)
+            fmt.Fprintf(w, "    %d -> %d [label=\"yes\"];\n", self, l)
+            r := walk(n.Right)
+            fmt.Fprintf(w, "    %d -> %d [label=\"no\"];\n", self, r)
+        }
+        return self
+    }
+    walk(root)
+    fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "log/slog"
+    "math"
+    "math/rand"
+    "os"
+    "runtime"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "time"
+)
+
+// SearchConfig is the search section of the config file: the hyperparameter
+// space the tune command explores and how candidates are scored.
+type SearchConfig struct {
+    // Strategy is "grid", which tries every combination of the listed
+    // values, or "random", which samples Trials candidates.
+    Strategy string `json:"strategy"`
+    Trials   int    `json:"trials"`
+    Folds    int    `json:"folds"`
+    // Metric ranks the candidates: "accuracy", "macro_f1" or "weighted_f1".
+    Metric string `json:"metric"`
+    // Workers bounds how many folds are trained at once. 0 means one per CPU.
+    Workers int                    `json:"workers"`
+    Params  map[string]SearchSpace `json:"params"`
+}
+
+// defaultSearch returns the settings used for anything the search section leaves out.
+func defaultSearch() *SearchConfig {
+    return &SearchConfig{Strategy: "grid", Trials: 10, Folds: 5, Metric: "accuracy"}
+}
+
+// SearchSpace is the set of values tried for one hyperparameter: either a
+// list of values, or for random search a range given as {min, max}. A range
+// with log set is sampled uniformly in log space, and one with integer set
+// is rounded to whole numbers.
+type SearchSpace struct {
+    Values  []any    `json:"values,omitempty"`
+    Min     *float64 `json:"min,omitempty"`
+    Max     *float64 `json:"max,omitempty"`
+    Log     bool     `json:"log,omitempty"`
+    Integer bool     `json:"integer,omitempty"`
+}
+
+// UnmarshalJSON accepts a plain list as shorthand for {values: [...]}.
+func (s *SearchSpace) UnmarshalJSON(data []byte) error {
+    var values []any
+    if err := json.Unmarshal(data, &values); err == nil {
+        *s = SearchSpace{Values: values}
+        return nil
+    }
+    type plain SearchSpace
+    return json.Unmarshal(data, (*plain)(s))
+}
+
+func (s SearchSpace) isRange() bool {
+    return s.Values == nil
+}
+
+// sample draws one value from s.
+func (s SearchSpace) sample(rng *rand.Rand) any {
+    if !s.isRange() {
+        return s.Values[rng.Intn(len(s.Values))]
+    }
+    lo, hi := *s.Min, *s.Max
+    var v float64
+    if s.Log {
+        v = math.Exp(math.Log(lo) + rng.Float64()*(math.Log(hi)-math.Log(lo)))
+    } else {
+        v = lo + rng.Float64()*(hi-lo)
+    }
+    if s.Integer {
+        v = math.Round(v)
+    }
+    return v
+}
+
+// validate checks the search settings and fills in defaults.
+func (sc *SearchConfig) validate() error {
+    def := defaultSearch()
+    if sc.Strategy == "" {
+        sc.Strategy = def.Strategy
+    }
+    if sc.Trials == 0 {
+        sc.Trials = def.Trials
+    }
+    if sc.Folds == 0 {
+        sc.Folds = def.Folds
+    }
+    if sc.Metric == "" {
+        sc.Metric = def.Metric
+    }
+    if sc.Strategy != "grid" && sc.Strategy != "random" {
+        return fmt.Errorf("search.strategy must be grid or random, not %q", sc.Strategy)
+    }
+    if _, ok := searchMetrics[sc.Metric]; !ok {
+        return fmt.Errorf("search.metric must be accuracy, macro_f1 or weighted_f1, not %q", sc.Metric)
+    }
+    if sc.Folds < 2 {
+        return fmt.Errorf("search.folds must be at least 2")
+    }
+    if sc.Trials < 1 || sc.Workers < 0 {
+        return fmt.Errorf("search.trials must be positive and search.workers must not be negative")
+    }
+    if len(sc.Params) == 0 {
+        return fmt.Errorf("search.params is empty")
+    }
+    for name, s := range sc.Params {
+        switch {
+        case !s.isRange() && len(s.Values) == 0:
+            return fmt.Errorf("search.params.%s has no values", name)
+        case s.isRange() && (s.Min == nil || s.Max == nil || *s.Min > *s.Max):
+            return fmt.Errorf("search.params.%s needs a list of values, or min and max with min <= max", name)
+        case s.isRange() && s.Log && *s.Min <= 0:
+            return fmt.Errorf("search.params.%s: a log range must be positive", name)
+        case s.isRange() && sc.Strategy == "grid":
+            return fmt.Errorf("search.params.%s: grid search needs a list of values, ranges are only for random search", name)
+        }
+    }
+    return nil
+}
+
+// searchMetrics are the scores a search can rank candidates by.
+var searchMetrics = map[string]func(*Evaluation) float64{
+    "accuracy":    func(e *Evaluation) float64 { return e.Accuracy },
+    "macro_f1":    func(e *Evaluation) float64 { return e.MacroAvg.F1 },
+    "weighted_f1": func(e *Evaluation) float64 { return e.WeightedAvg.F1 },
+}
+
+// candidates returns the hyperparameter sets to try, each base overlaid with
+// values from the search space.
+func (sc *SearchConfig) candidates(base Params, seed int64) []Params {
+    names := make([]string, 0, len(sc.Params))
+    for name := range sc.Params {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    with := func(values map[string]any) Params {
+        p := Params{}
+        for k, v := range base {
+            p[k] = v
+        }
+        for k, v := range values {
+            p[k] = v
+        }
+        return p
+    }
+
+    var out []Params
+    if sc.Strategy == "random" {
+        rng := rand.New(rand.NewSource(seed))
+        for i := 0; i < sc.Trials; i++ {
+            values := map[string]any{}
+            for _, name := range names {
+                values[name] = sc.Params[name].sample(rng)
+            }
+            out = append(out, with(values))
+        }
+        return out
+    }
+    // Grid: count through every combination like an odometer, the last name
+    // changing fastest.
+    idx := make([]int, len(names))
+    for {
+        values := map[string]any{}
+        for i, name := range names {
+            values[name] = sc.Params[name].Values[idx[i]]
+        }
+        out = append(out, with(values))
+        i := len(idx) - 1
+        for ; i >= 0; i-- {
+            if idx[i]++; idx[i] < len(sc.Params[names[i]].Values) {
+                break
+            }
+            idx[i] = 0
+        }
+        if i < 0 {
+            return out
+        }
+    }
+}
+
+// folds deals the rows of each class round-robin, in a seeded random order,
+// into k folds of roughly equal size and class balance. It returns the row
+// indices of each fold.
+func (ds *Dataset) folds(k int, seed int64) [][]int {
+    rng := rand.New(rand.NewSource(seed))
+    byClass := make([][]int, len(ds.Classes))
+    for i, y := range ds.Y {
+        byClass[y] = append(byClass[y], i)
+    }
+    folds := make([][]int, k)
+    next := 0
+    for _, rows := range byClass {
+        rng.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+        for _, row := range rows {
+            folds[next] = append(folds[next], row)
+            next = (next + 1) % k
+        }
+    }
+    return folds
+}
+
+// SearchResult is the cross-validated score of one candidate.
+type SearchResult struct {
+    Rank       int       `json:"rank"`
+    Params     Params    `json:"params"`
+    Mean       float64   `json:"mean"`
+    Std        float64   `json:"std"`
+    FoldScores []float64 `json:"fold_scores"`
+    // FitSeconds is the mean time to train and score one fold.
+    FitSeconds float64 `json:"fit_seconds"`
+    Error      string  `json:"error,omitempty"`
+}
+
+// crossValidate scores every candidate with stratified k-fold cross-validation
+// on ds, training up to workers folds at once. The results are ranked best
+// first; candidates that failed to train rank last.
+func crossValidate(algorithm string, candidates []Params, ds *Dataset, sc *SearchConfig, seed int64) []SearchResult {
+    folds := ds.folds(sc.Folds, seed)
+    type job struct{ candidate, fold int }
+    jobs := make(chan job)
+    results := make([]SearchResult, len(candidates))
+    fitTimes := make([][]time.Duration, len(candidates))
+    for i, p := range candidates {
+        results[i] = SearchResult{Params: p, FoldScores: make([]float64, sc.Folds)}
+        fitTimes[i] = make([]time.Duration, sc.Folds)
+    }
+    var mu sync.Mutex
+    score := searchMetrics[sc.Metric]
+
+    workers := sc.Workers
+    if workers == 0 {
+        workers = runtime.GOMAXPROCS(0)
+    }
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := range jobs {
+                start := time.Now()
+                e, err := fitFold(algorithm, candidates[j.candidate], ds, folds, j.fold, seed)
+                mu.Lock()
+                r := &results[j.candidate]
+                if err != nil && r.Error == "" {
+                    r.Error = fmt.Sprintf("fold %d: %v", j.fold+1, err)
+                } else if err == nil {
+                    r.FoldScores[j.fold] = score(e)
+                    fitTimes[j.candidate][j.fold] = time.Since(start)
+                }
+                mu.Unlock()
+            }
+        }()
+    }
+    for c := range candidates {
+        for f := range folds {
+            jobs <- job{c, f}
+        }
+    }
+    close(jobs)
+    wg.Wait()
+
+    for i := range results {
+        r := &results[i]
+        var total time.Duration
+        for f, s := range r.FoldScores {
+            r.Mean += s / float64(len(folds))
+            total += fitTimes[i][f]
+        }
+        for _, s := range r.FoldScores {
+            r.Std += (s - r.Mean) * (s - r.Mean) / float64(len(folds))
+        }
+        r.Std = math.Sqrt(r.Std)
+        r.FitSeconds = total.Seconds() / float64(len(folds))
+    }
+    sort.SliceStable(results, func(i, j int) bool {
+        a, b := results[i], results[j]
+        if (a.Error == "") != (b.Error == "") {
+            return a.Error == ""
+        }
+        return a.Mean > b.Mean
+    })
+    for i := range results {
+        results[i].Rank = i + 1
+    }
+    return results
+}
+
+// fitFold trains a candidate on every fold but one and evaluates it on that one.
+func fitFold(algorithm string, params Params, ds *Dataset, folds [][]int, held int, seed int64) (*Evaluation, error) {
+    var trainRows []int
+    for f, rows := range folds {
+        if f != held {
+            trainRows = append(trainRows, rows...)
+        }
+    }
+    sort.Ints(trainRows)
+    p, err := newPredictor(algorithm, params)
+    if err != nil {
+        return nil, err
+    }
+    // Fold models are trained folds × candidates times; only the search
+    // itself is logged.
+    if l, ok := p.(interface{ setLogger(*slog.Logger) }); ok {
+        l.setLogger(discardLogger)
+    }
+    if t, ok := p.(Trainer); ok {
+        if err := t.Fit(ds.subset(trainRows), rand.New(rand.NewSource(seed))); err != nil {
+            return nil, err
+        }
+    }
+    test := ds.subset(folds[held])
+    actual := make([]string, len(test.X))
+    predicted := make([]string, len(test.X))
+    for i, row := range test.X {
+        out, err := p.Predict(row)
+        if err != nil {
+            return nil, err
+        }
+        actual[i], predicted[i] = ds.Classes[test.Y[i]], p.Schema().Classes[out]
+    }
+    return newEvaluation(actual, predicted), nil
+}
+
+// runTune implements the tune command: it cross-validates every candidate in
+// the configured search space on the training rows, prints the ranking, and
+// retrains the best candidate on them.
+func runTune(args []string) error {
+    cfg, err := commandConfig("tune", "tune [-model artifact] [flags]",
+        "Searches the hyperparameters in the config file's search section with stratified k-fold\ncross-validation, then trains the best candidate and writes it to -model if set.", args, false)
+    if err != nil {
+        return err
+    }
+    if cfg.Search == nil {
+        return fmt.Errorf("the config file has no search section")
+    }
+    sc := cfg.Search
+    ds, err := loadTrainingData(cfg.DataPath, csvOptions{Label: cfg.Label, Features: cfg.Features})
+    if err != nil {
+        return err
+    }
+    ds.RangeMargin = cfg.RangeMargin
+    ds.FillMissing = cfg.FillMissing
+
+    // Tune on the same rows trainModel will train on, so the held-out rows
+    // stay unseen until the final evaluation.
+    train := ds
+    if cfg.TestFraction > 0 {
+        train, _ = ds.split(cfg.TestFraction, cfg.Seed)
+    }
+    candidates := sc.candidates(cfg.Params, cfg.Seed)
+    for _, p := range candidates {
+        if _, err := newPredictor(cfg.Algorithm, p); err != nil {
+            return fmt.Errorf("search.params: %w", err)
+        }
+    }
+    slog.Info("tuning model", "algorithm", cfg.Algorithm, "strategy", sc.Strategy, "candidates", len(candidates),
+        "folds", sc.Folds, "rows", len(train.X), "metric", sc.Metric)
+    start := time.Now()
+    results := crossValidate(cfg.Algorithm, candidates, train, sc, cfg.Seed)
+    slog.Info("tuning finished", "duration_ms", time.Since(start).Milliseconds())
+    printSearch(os.Stdout, sc, results)
+
+    best := results[0]
+    if best.Error != "" {
+        return fmt.Errorf("every candidate failed; first error: %s", best.Error)
+    }
+    m, err := trainModel(cfg.Algorithm, best.Params, ds, cfg.Seed, cfg.TestFraction)
+    if err != nil {
+        return err
+    }
+    if m.Evaluation != nil {
+        fmt.Printf("\nBest candidate retrained; evaluation on %d held-out rows\n", m.Evaluation.Rows)
+        m.Evaluation.print(os.Stdout)
+    }
+    if cfg.ModelPath != "" {
+        if err := saveModel(m, cfg.ModelPath); err != nil {
+            return err
+        }
+        fmt.Printf("\nwrote %s model %s to %s\n", m.Algorithm, m.Version, cfg.ModelPath)
+    }
+    return nil
+}
+
+// printSearch writes the ranked results of a search as a table.
+func printSearch(out io.Writer, sc *SearchConfig, results []SearchResult) {
+    fmt.Fprintf(out, "%s search, %d candidates, %d-fold cross-validation, ranked by %s\n\n",
+        sc.Strategy, len(results), sc.Folds, sc.Metric)
+    names := make([]string, 0, len(sc.Params))
+    for name := range sc.Params {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+    fmt.Fprintf(tw, "RANK\tMEAN\tSTD\tFIT SECONDS\t%s\n", strings.ToUpper(strings.Join(names, "\t")))
+    for _, r := range results {
+        cells := make([]string, len(names))
+        for i, name := range names {
+            cells[i] = fmt.Sprint(r.Params[name])
+            if f, ok := r.Params[name].(float64); ok {
+                cells[i] = strconv.FormatFloat(f, 'g', 4, 64)
+            }
+        }
+        if r.Error != "" {
+            fmt.Fprintf(tw, "%d\t-\t-\t-\t%s\terror: %s\n", r.Rank, strings.Join(cells, "\t"), r.Error)
+            continue
+        }
+        fmt.Fprintf(tw, "%d\t%.4f\t%.4f\t%.3f\t%s\n", r.Rank, r.Mean, r.Std, r.FitSeconds, strings.Join(cells, "\t"))
+    }
+    tw.Flush()
+}
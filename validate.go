@@ -0,0 +1,185 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Violation is one way an input fails to match the model's schema. Index is
+// the position in the input vector, or -1 for a named feature the schema
+// does not have; Field is the feature name, empty for positions the schema
+// does not have.
+type Violation struct {
+    Field   string `json:"field,omitempty"`
+    Index   int    `json:"index"`
+    Value   any    `json:"value,omitempty"`
+    Message string `json:"message"`
+}
+
+// ValidationError lists every violation found in one input.
+type ValidationError struct {
+    Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+    msgs := make([]string, len(e.Violations))
+    for i, v := range e.Violations {
+        if v.Field != "" {
+            msgs[i] = v.Field + ": " + v.Message
+        } else {
+            msgs[i] = fmt.Sprintf("index %d: %s", v.Index, v.Message)
+        }
+    }
+    return "input does not match the model schema: " + strings.Join(msgs, "; ")
+}
+
+// ErrorResponse is the JSON body of an error response.
+type ErrorResponse struct {
+    Error      string      `json:"error"`
+    Violations []Violation `json:"violations,omitempty"`
+}
+
+// writeError responds with status and an ErrorResponse.
+func writeError(w http.ResponseWriter, status int, resp ErrorResponse) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(resp)
+}
+
+// decodeInput parses a JSON input and validates it against s. The input is
+// either an array of values in schema order or an object keyed by feature
+// name. Malformed JSON, including data after the input, is returned as a
+// plain error; input that is valid JSON but does not satisfy the schema is
+// returned as a *ValidationError.
+func decodeInput(raw []byte, s Schema) ([]float64, error) {
+    dec := json.NewDecoder(bytes.NewReader(raw))
+    dec.UseNumber()
+    if trimmed := bytes.TrimLeft(raw, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+        var named map[string]any
+        if err := decodeOnly(dec, &named); err != nil {
+            return nil, err
+        }
+        return s.validateNamed(named)
+    }
+    var values []any
+    if err := decodeOnly(dec, &values); err != nil {
+        return nil, err
+    }
+    return s.validate(values)
+}
+
+// decodeOnly decodes the next JSON value from dec into v and fails if
+// anything other than whitespace follows it.
+func decodeOnly(dec *json.Decoder, v any) error {
+    if err := dec.Decode(v); err != nil {
+        return err
+    }
+    if err := dec.Decode(&struct{}{}); err != io.EOF {
+        return fmt.Errorf("unexpected data after the input")
+    }
+    return nil
+}
+
+// validateNamed orders a named-feature input by the schema and validates it.
+// Features the input leaves out take their default if they have one.
+func (s Schema) validateNamed(named map[string]any) ([]float64, error) {
+    if len(s.Features) == 0 {
+        return nil, &ValidationError{Violations: []Violation{{Index: -1,
+            Message: "the model does not name its features, send an array of values"}}}
+    }
+    var violations []Violation
+    input := make([]float64, len(s.Features))
+    known := make(map[string]bool, len(s.Features))
+    for i, f := range s.Features {
+        known[f.Name] = true
+        value, ok := named[f.Name]
+        switch {
+        case ok:
+            v, msg := f.check(value)
+            if msg != "" {
+                violations = append(violations, Violation{Field: f.Name, Index: i, Value: value, Message: msg})
+            }
+            input[i] = v
+        case f.Default != nil:
+            input[i] = *f.Default
+        default:
+            violations = append(violations, Violation{Field: f.Name, Index: i, Message: "missing value"})
+        }
+    }
+    var unknown []string
+    for name := range named {
+        if !known[name] {
+            unknown = append(unknown, name)
+        }
+    }
+    sort.Strings(unknown)
+    for _, name := range unknown {
+        violations = append(violations, Violation{Field: name, Index: -1, Value: named[name], Message: "unknown feature"})
+    }
+    if len(violations) > 0 {
+        return nil, &ValidationError{Violations: violations}
+    }
+    return input, nil
+}
+
+// validate converts decoded JSON values into an input vector, collecting a
+// violation for every value that is not a finite number, has the wrong type,
+// or falls outside its feature's allowed range.
+func (s Schema) validate(values []any) ([]float64, error) {
+    var violations []Violation
+    if len(values) == 0 {
+        violations = append(violations, Violation{Message: "input is empty"})
+    }
+    input := make([]float64, len(values))
+    for i, value := range values {
+        var f Feature
+        if i < len(s.Features) {
+            f = s.Features[i]
+        } else if len(s.Features) > 0 {
+            violations = append(violations, Violation{Index: i, Value: value,
+                Message: fmt.Sprintf("unexpected value, the model has %d features", len(s.Features))})
+            continue
+        }
+        v, msg := f.check(value)
+        if msg != "" {
+            violations = append(violations, Violation{Field: f.Name, Index: i, Value: value, Message: msg})
+        }
+        input[i] = v
+    }
+    for i := len(values); i < len(s.Features) && len(values) > 0; i++ {
+        violations = append(violations, Violation{Field: s.Features[i].Name, Index: i, Message: "missing value"})
+    }
+    if len(violations) > 0 {
+        return nil, &ValidationError{Violations: violations}
+    }
+    return input, nil
+}
+
+// check converts one decoded JSON value for f, returning a message
+// describing why it is not acceptable, or "" if it is.
+func (f Feature) check(value any) (float64, string) {
+    n, ok := value.(json.Number)
+    if !ok {
+        return 0, "must be a number"
+    }
+    v, err := strconv.ParseFloat(n.String(), 64)
+    if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+        return 0, "must be a finite number"
+    }
+    switch {
+    case f.Type == featureInteger && v != math.Trunc(v):
+        return v, "must be an integer"
+    case f.Min != nil && v < *f.Min:
+        return v, fmt.Sprintf("must be at least %g", *f.Min)
+    case f.Max != nil && v > *f.Max:
+        return v, fmt.Sprintf("must be at most %g", *f.Max)
+    }
+    return v, ""
+}
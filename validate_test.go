@@ -0,0 +1,127 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "strings"
+    "testing"
+)
+
+func TestDecodeInput(t *testing.T) {
+    lo, hi, def := 0.0, 10.0, 5.0
+    schema := Schema{
+        Features: []Feature{
+            {Name: "width", Type: featureNumber, Min: &lo, Max: &hi},
+            {Name: "count", Type: featureInteger, Default: &def},
+        },
+        Classes: []string{"a", "b"},
+    }
+    tests := []struct {
+        name string
+        in   string
+        want []float64
+        // violations lists the expected violation messages; nil means the
+        // input is valid, unless malformed is set.
+        violations []string
+        malformed  bool
+    }{
+        {name: "array", in: "[1.5, 3]", want: []float64{1.5, 3}},
+        {name: "surrounding whitespace", in: " \n[1.5, 3]\r\n ", want: []float64{1.5, 3}},
+        {name: "named", in: `{"count": 3, "width": 1.5}`, want: []float64{1.5, 3}},
+        {name: "named uses default", in: `{"width": 1.5}`, want: []float64{1.5, 5}},
+        {name: "empty array", in: "[]", violations: []string{"input is empty"}},
+        {name: "too short", in: "[1.5]", violations: []string{"missing value"}},
+        {name: "too long", in: "[1.5, 3, 4]", violations: []string{"unexpected value, the model has 2 features"}},
+        {name: "non-number", in: `["wide", true]`, violations: []string{"must be a number", "must be a number"}},
+        {name: "null", in: "[null, 3]", violations: []string{"must be a number"}},
+        {name: "out of range", in: "[-1, 3]", violations: []string{"must be at least 0"}},
+        {name: "above range", in: "[11, 3]", violations: []string{"must be at most 10"}},
+        {name: "not an integer", in: "[1, 3.5]", violations: []string{"must be an integer"}},
+        {name: "too large to be finite", in: "[1e999, 3]", violations: []string{"must be a finite number"}},
+        {name: "unknown and missing names", in: `{"height": 1}`, violations: []string{"missing value", "unknown feature"}},
+        {name: "empty body", in: "", malformed: true},
+        {name: "invalid JSON", in: "[1.5, ", malformed: true},
+        {name: "not an array or object", in: "1.5", malformed: true},
+        {name: "trailing garbage", in: "[1.5, 3] garbage", malformed: true},
+        {name: "trailing array", in: "[1.5, 3][1]", malformed: true},
+        {name: "trailing object", in: `{"width": 1.5} {}`, malformed: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := decodeInput([]byte(tt.in), schema)
+            var verr *ValidationError
+            switch {
+            case tt.malformed:
+                if err == nil || errors.As(err, &verr) {
+                    t.Fatalf("decodeInput = %v, %v; want a malformed-input error", got, err)
+                }
+            case tt.violations != nil:
+                if !errors.As(err, &verr) {
+                    t.Fatalf("decodeInput = %v, %v; want a *ValidationError", got, err)
+                }
+                var msgs []string
+                for _, v := range verr.Violations {
+                    msgs = append(msgs, v.Message)
+                }
+                if !slices.Equal(msgs, tt.violations) {
+                    t.Errorf("violations = %q, want %q", msgs, tt.violations)
+                }
+            default:
+                if err != nil {
+                    t.Fatalf("decodeInput: %v", err)
+                }
+                if !slices.Equal(got, tt.want) {
+                    t.Errorf("decodeInput = %v, want %v", got, tt.want)
+                }
+            }
+        })
+    }
+}
+
+func TestPredictHandlerStatus(t *testing.T) {
+    ds, err := loadTrainingData("", csvOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    m, err := trainModel("tree", Params{}, ds, 1, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    serveModel(m)
+    defer current.Store(nil)
+
+    tests := []struct {
+        name       string
+        body       string
+        status     int
+        violations int
+    }{
+        {"valid", "[5.1, 3.5, 1.4, 0.2]", http.StatusOK, 0},
+        {"out of range", "[5.1, 3.5, 1.4, 100]", http.StatusUnprocessableEntity, 1},
+        {"wrong length", "[5.1, 3.5]", http.StatusUnprocessableEntity, 2},
+        {"trailing data", "[5.1, 3.5, 1.4, 0.2] garbage", http.StatusBadRequest, 0},
+        {"malformed", "[5.1,", http.StatusBadRequest, 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rec := httptest.NewRecorder()
+            predictHandler(rec, httptest.NewRequest(http.MethodPost, "/predict", strings.NewReader(tt.body)))
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+            }
+            if tt.status != http.StatusUnprocessableEntity {
+                return
+            }
+            var resp ErrorResponse
+            if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+                t.Fatal(err)
+            }
+            if len(resp.Violations) != tt.violations {
+                t.Errorf("violations = %+v, want %d", resp.Violations, tt.violations)
+            }
+        })
+    }
+}
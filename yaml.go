@@ -0,0 +1,265 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// parseYAML parses the subset of YAML used by config files: nested block
+// mappings and sequences, scalars (strings, numbers, booleans, null) and
+// single-line flow sequences like [0.1, 0.01]. Anchors, multi-line strings
+// and multiple documents are not supported. The result is made of
+// map[string]any, []any, string, float64, bool and nil, like encoding/json.
+func parseYAML(data []byte) (any, error) {
+    var p yamlParser
+    for i, text := range strings.Split(string(data), "\n") {
+        text = strings.TrimRight(stripYAMLComment(text), " \t\r")
+        trimmed := strings.TrimLeft(text, " ")
+        if trimmed == "" || trimmed == "---" {
+            continue
+        }
+        if strings.HasPrefix(trimmed, "\t") {
+            return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+        }
+        p.lines = append(p.lines, yamlLine{indent: len(text) - len(trimmed), text: trimmed, num: i + 1})
+    }
+    if len(p.lines) == 0 {
+        return map[string]any{}, nil
+    }
+    v, err := p.block(p.lines[0].indent)
+    if err == nil && p.pos < len(p.lines) {
+        err = fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+    }
+    return v, err
+}
+
+type yamlLine struct {
+    indent int
+    text   string
+    num    int
+}
+
+type yamlParser struct {
+    lines []yamlLine
+    pos   int
+}
+
+func isYAMLItem(text string) bool {
+    return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// block parses the mapping or sequence starting at the current line.
+func (p *yamlParser) block(indent int) (any, error) {
+    if isYAMLItem(p.lines[p.pos].text) {
+        return p.sequence(indent)
+    }
+    return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+    m := map[string]any{}
+    for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+        line := p.lines[p.pos]
+        if isYAMLItem(line.text) {
+            return nil, fmt.Errorf("line %d: expected key: value, got a list item", line.num)
+        }
+        colon := indexUnquoted(line.text, ":")
+        if colon < 0 {
+            if _, err := yamlScalarString(line.text); err != nil {
+                return nil, fmt.Errorf("line %d: %w", line.num, err)
+            }
+        }
+        if colon < 0 || (colon+1 < len(line.text) && line.text[colon+1] != ' ') {
+            return nil, fmt.Errorf("line %d: expected key: value", line.num)
+        }
+        rest := line.text[colon+1:]
+        key, err := yamlScalarString(strings.TrimSpace(line.text[:colon]))
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", line.num, err)
+        }
+        if _, dup := m[key]; dup {
+            return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+        }
+        p.pos++
+        var v any
+        switch rest = strings.TrimSpace(rest); {
+        case rest != "":
+            v, err = yamlValue(rest)
+        case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+            v, err = p.block(p.lines[p.pos].indent)
+        case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLItem(p.lines[p.pos].text):
+            v, err = p.sequence(indent)
+        }
+        if err != nil {
+            return nil, addYAMLLine(err, line.num)
+        }
+        m[key] = v
+    }
+    if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+        return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+    }
+    return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+    list := []any{}
+    for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLItem(p.lines[p.pos].text) {
+        line := p.lines[p.pos]
+        item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+        var v any
+        var err error
+        switch {
+        case item == "":
+            p.pos++
+            if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+                v, err = p.block(p.lines[p.pos].indent)
+            }
+        case indexUnquoted(item+" ", ": ") >= 0:
+            // "- key: value" starts a mapping indented to the item's text.
+            p.lines[p.pos] = yamlLine{indent: line.indent + len(line.text) - len(item), text: item, num: line.num}
+            v, err = p.mapping(p.lines[p.pos].indent)
+        default:
+            p.pos++
+            v, err = yamlValue(item)
+        }
+        if err != nil {
+            return nil, addYAMLLine(err, line.num)
+        }
+        list = append(list, v)
+    }
+    return list, nil
+}
+
+// yamlValue parses an inline value: a scalar or a flow sequence of scalars.
+func yamlValue(s string) (any, error) {
+    if !strings.HasPrefix(s, "[") {
+        if strings.HasPrefix(s, "{") {
+            if s == "{}" {
+                return map[string]any{}, nil
+            }
+            return nil, fmt.Errorf("flow mappings are not supported, use an indented block")
+        }
+        return yamlScalar(s)
+    }
+    if !strings.HasSuffix(s, "]") {
+        return nil, fmt.Errorf("unterminated flow sequence %q", s)
+    }
+    list := []any{}
+    inner := strings.TrimSpace(s[1 : len(s)-1])
+    if inner == "" {
+        return list, nil
+    }
+    for _, item := range splitUnquoted(inner, ",") {
+        v, err := yamlScalar(strings.TrimSpace(item))
+        if err != nil {
+            return nil, err
+        }
+        list = append(list, v)
+    }
+    return list, nil
+}
+
+func yamlScalar(s string) (any, error) {
+    switch s {
+    case "", "~", "null":
+        return nil, nil
+    case "true":
+        return true, nil
+    case "false":
+        return false, nil
+    }
+    if s[0] == '"' || s[0] == '\'' {
+        return yamlScalarString(s)
+    }
+    if yamlNumber.MatchString(s) {
+        f, err := strconv.ParseFloat(s, 64)
+        if err != nil {
+            return nil, fmt.Errorf("number %s is out of range", s)
+        }
+        return f, nil
+    }
+    return s, nil
+}
+
+// yamlNumber matches YAML's decimal number syntax. Anything else, such as
+// NaN, inf or hexadecimal, is a string.
+var yamlNumber = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// yamlScalarString returns s with any quotes removed.
+func yamlScalarString(s string) (string, error) {
+    switch {
+    case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+        return strconv.Unquote(s)
+    case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+        return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+    case s != "" && (s[0] == '"' || s[0] == '\''):
+        return "", fmt.Errorf("unterminated string %s", s)
+    }
+    return s, nil
+}
+
+// indexUnquoted returns the index of the first sep in s that is outside any
+// quoted scalar, or -1. A quote only starts a scalar at the start of s or
+// after a space, comma or opening bracket, so apostrophes inside plain
+// scalars such as don't are ignored.
+func indexUnquoted(s, sep string) int {
+    var quote byte
+    for i := 0; i < len(s); i++ {
+        switch c := s[i]; {
+        case quote == '"' && c == '\\':
+            i++
+        case quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+            i++
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            }
+        case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" ,[", s[i-1]) >= 0):
+            quote = c
+        case strings.HasPrefix(s[i:], sep):
+            return i
+        }
+    }
+    return -1
+}
+
+// splitUnquoted splits s around each sep that is outside any quoted scalar.
+func splitUnquoted(s, sep string) []string {
+    var parts []string
+    for {
+        i := indexUnquoted(s, sep)
+        if i < 0 {
+            return append(parts, s)
+        }
+        parts = append(parts, s[:i])
+        s = s[i+len(sep):]
+    }
+}
+
+// stripYAMLComment removes a trailing # comment that is not inside quotes.
+func stripYAMLComment(line string) string {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        switch c := line[i]; {
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+            return line[:i]
+        }
+    }
+    return line
+}
+
+// addYAMLLine prefixes err with a line number unless it already has one.
+func addYAMLLine(err error, num int) error {
+    if strings.HasPrefix(err.Error(), "line ") {
+        return err
+    }
+    return fmt.Errorf("line %d: %w", num, err)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseYAML(t *testing.T) {
+    tests := []struct {
+        name string
+        in   string
+        want any
+    }{
+        {"empty", "", map[string]any{}},
+        {"only comments", "# nothing here\n---\n", map[string]any{}},
+        {
+            "scalars",
+            "s: hello world\nn: 0.25\ni: -3\nt: true\nf: false\nnull1: null\nnull2: ~\nnull3:\n",
+            map[string]any{"s": "hello world", "n": 0.25, "i": -3.0, "t": true, "f": false, "null1": nil, "null2": nil, "null3": nil},
+        },
+        {
+            "nested maps",
+            "algorithm: logistic\nparams:\n  learning_rate: 0.1\n  nested:\n    deep: 1\nseed: 7\n",
+            map[string]any{
+                "algorithm": "logistic",
+                "params":    map[string]any{"learning_rate": 0.1, "nested": map[string]any{"deep": 1.0}},
+                "seed":      7.0,
+            },
+        },
+        {
+            "indented sequence",
+            "features:\n  - a\n  - b\n",
+            map[string]any{"features": []any{"a", "b"}},
+        },
+        {
+            "sequence at key indentation",
+            "features:\n- a\n- 2\n",
+            map[string]any{"features": []any{"a", 2.0}},
+        },
+        {
+            "sequence of maps",
+            "items:\n  - name: x\n    value: 1\n  - name: y\n    value: 2\n",
+            map[string]any{"items": []any{
+                map[string]any{"name": "x", "value": 1.0},
+                map[string]any{"name": "y", "value": 2.0},
+            }},
+        },
+        {
+            "item holding a block",
+            "items:\n  -\n    a: 1\n  -\n",
+            map[string]any{"items": []any{map[string]any{"a": 1.0}, nil}},
+        },
+        {"top-level sequence", "- 1\n- two\n", []any{1.0, "two"}},
+        {
+            "flow sequences",
+            "a: [0.1, 0.01, 'x', \"y\"]\nb: []\nc: {}\n",
+            map[string]any{"a": []any{0.1, 0.01, "x", "y"}, "b": []any{}, "c": map[string]any{}},
+        },
+        {
+            "quoting",
+            "dq: \"a: b # not a comment\"\nsq: 'it''s'\nesc: \"tab\\there\"\n\"quoted key\": 1\nnum: \"42\"\nbool: 'true'\n",
+            map[string]any{"dq": "a: b # not a comment", "sq": "it's", "esc": "tab\there", "quoted key": 1.0, "num": "42", "bool": "true"},
+        },
+        {
+            "comments",
+            "# header\na: 1 # trailing\nb: x#y\n  # indented comment\nc: 2\n",
+            map[string]any{"a": 1.0, "b": "x#y", "c": 2.0},
+        },
+        {"CRLF line endings", "a: 1\r\nb: 2\r\n", map[string]any{"a": 1.0, "b": 2.0}},
+        {
+            "commas inside quoted flow items",
+            "features: ['a,b', c, \"x, y\", 'it''s, ok', don't]\n",
+            map[string]any{"features": []any{"a,b", "c", "x, y", "it's, ok", "don't"}},
+        },
+        {
+            "quoted list items containing colons",
+            "- \"a: b\"\n- 'k: v'\n- \"trailing:\"\n",
+            []any{"a: b", "k: v", "trailing:"},
+        },
+        {
+            "list item with a quoted key",
+            "- \"a: b\": 1\n",
+            []any{map[string]any{"a: b": 1.0}},
+        },
+        {
+            "colons in keys and values",
+            "\"a:b\": 1\nurl: http://localhost:8080/predict\n",
+            map[string]any{"a:b": 1.0, "url": "http://localhost:8080/predict"},
+        },
+        {
+            "decimal numbers",
+            "a: 1.\nb: .5\nc: +2\nd: 1e3\ne: -1.5E-2\n",
+            map[string]any{"a": 1.0, "b": 0.5, "c": 2.0, "d": 1000.0, "e": -0.015},
+        },
+        {
+            "non-decimal numbers are strings",
+            "a: NaN\nb: inf\nc: -Infinity\nd: 0x1p3\ne: 1_000\nf: .inf\ng: 0b101\n",
+            map[string]any{"a": "NaN", "b": "inf", "c": "-Infinity", "d": "0x1p3", "e": "1_000", "f": ".inf", "g": "0b101"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseYAML([]byte(tt.in))
+            if err != nil {
+                t.Fatalf("parseYAML: %v", err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("parseYAML = %#v, want %#v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        in   string
+        want string
+    }{
+        {"tab indentation", "a:\n\tb: 1\n", "line 2: tabs are not allowed"},
+        {"flow mapping", "a: {b: 1}\n", "line 1: flow mappings are not supported"},
+        {"unterminated flow sequence", "a: [1, 2\n", "line 1: unterminated flow sequence"},
+        {"unterminated string", "a: \"abc\n", "line 1: unterminated string"},
+        {"unterminated key", "'a: 1\n", "line 1: unterminated string"},
+        {"duplicate key", "a: 1\na: 2\n", `line 2: duplicate key "a"`},
+        {"missing colon", "a: 1\nb\n", "line 2: expected key: value"},
+        {"no space after colon", "a:1\n", "line 1: expected key: value"},
+        {"list item in mapping", "a: 1\n- b\n", "line 2: expected key: value, got a list item"},
+        {"unexpected indentation", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+        {"dedent below document", "  a: 1\nb: 2\n", "line 2: unexpected indentation"},
+        {"error in nested block", "a:\n  b:\n    c: [1\n", "line 3: unterminated flow sequence"},
+        {"number out of range", "a: 1e999\n", "line 1: number 1e999 is out of range"},
+        {"unterminated quote in flow sequence", "a: ['x, y]\n", "line 1: unterminated string"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := parseYAML([]byte(tt.in))
+            if err == nil {
+                t.Fatalf("parseYAML succeeded, want error containing %q", tt.want)
+            }
+            if !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("parseYAML error = %q, want it to contain %q", err, tt.want)
+            }
+        })
+    }
+}